@@ -0,0 +1,31 @@
+// Package browser opens URLs in the default web browser.
+package browser
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// Open opens the URL in the default web browser. It doesn't wait for the
+// browser to exit.
+func Open(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+
+	// Release resources of the process without waiting for it.
+	go cmd.Wait()
+
+	return nil
+}
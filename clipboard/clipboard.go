@@ -0,0 +1,81 @@
+// Package clipboard copies text to the system clipboard.
+package clipboard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Write copies text to the clipboard using the first available clipboard
+// tool. Without one, e.g. over SSH, the terminal is asked to set the
+// clipboard with an OSC 52 escape sequence, which most terminal emulators
+// support.
+func Write(text string) error {
+	for _, args := range commands() {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		// xclip and wl-copy fork to serve the clipboard and keep their
+		// stdout and stderr open, so capturing output would wait for them
+		// to exit, which is when the clipboard is taken over by someone
+		// else.
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s: %w", args[0], err)
+		}
+		return nil
+	}
+
+	return osc52(text)
+}
+
+// commands returns clipboard tools for the platform in order of preference.
+func commands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip.exe"}}
+	}
+
+	// Without a display server, clipboard tools fail, but the terminal
+	// may still accept OSC 52.
+	var cmds [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		cmds = append(cmds, []string{"wl-copy"})
+	}
+	if os.Getenv("DISPLAY") != "" {
+		cmds = append(cmds,
+			[]string{"xclip", "-selection", "clipboard"},
+			[]string{"xsel", "--clipboard", "--input"},
+		)
+	}
+	return cmds
+}
+
+// osc52 asks the terminal to set the clipboard.
+func osc52(text string) error {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return errors.New("no clipboard tool found and stdout is not a terminal")
+	}
+
+	seq := "\033]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+
+	// tmux only passes the sequence through to the outer terminal when it
+	// is wrapped in a DCS passthrough sequence.
+	if os.Getenv("TMUX") != "" {
+		seq = "\033Ptmux;" + strings.ReplaceAll(seq, "\033", "\033\033") + "\033\\"
+	}
+
+	_, err := fmt.Fprint(os.Stdout, seq)
+	return err
+}
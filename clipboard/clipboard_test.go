@@ -0,0 +1,43 @@
+package clipboard
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWriteForkingTool(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("xclip is only used on linux")
+	}
+
+	// Like xclip, the fake keeps running in the background after reading
+	// the text, with stdout and stderr still open.
+	dir := t.TempDir()
+	copied := filepath.Join(dir, "copied")
+	script := "#!/bin/sh\ncat > " + copied + "\nsleep 10 &\n"
+	if err := os.WriteFile(filepath.Join(dir, "xclip"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+":/bin:/usr/bin")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	t.Setenv("DISPLAY", ":0")
+
+	start := time.Now()
+	if err := Write("token"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("waited %s for the background process", elapsed)
+	}
+
+	b, err := os.ReadFile(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "token" {
+		t.Errorf("copied %q, want %q", b, "token")
+	}
+}
@@ -1,21 +1,30 @@
 package ceph
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"os"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/live"
+	"github.com/romantomjak/labctl/power"
 	"github.com/romantomjak/labctl/ssh"
-	"github.com/romantomjak/labctl/wakeonlan"
+	"github.com/romantomjak/labctl/wait"
 )
 
 var bootExample = strings.Trim(`
   # Start ceph cluster
   labctl ceph boot
+
+  # Start ceph cluster as soon as two nodes are up
+  labctl ceph boot --quorum 2
 `, "\n")
 
 var boot = &cobra.Command{
@@ -33,66 +42,83 @@ func bootCommandFunc(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("load configuration: %w", err)
 	}
 
-	fmt.Println("📡 Broadcasting Wake-on-LAN packets")
-	for _, node := range cfg.Ceph.Nodes {
-		if err := wakeonlan.Broadcast(node.MAC); err != nil {
-			return fmt.Errorf("wake on lan: %w", err)
-		}
+	applyTimeoutFlags(cfg)
+
+	if len(cfg.Ceph.Nodes) == 0 {
+		return fmt.Errorf("no hosts defined in configuration")
 	}
 
-	fmt.Println("⏳ Waiting for ssh to become available")
-	var node config.Node
-SSHLOOP:
-	for {
-		select {
-		case <-time.Tick(time.Second):
-			if n, ok := firstAvailable(cfg.Ceph.Nodes); ok {
-				fmt.Println(BrightBlack + " ↳ Node " + n.Name + " is first available" + Reset)
-				node = n
-				break SSHLOOP
+	quorum := flagBootQuorum
+	if quorum == 0 {
+		quorum = len(cfg.Ceph.Nodes)
+	}
+	if quorum < 0 || quorum > len(cfg.Ceph.Nodes) {
+		return fmt.Errorf("quorum must be between 1 and %d", len(cfg.Ceph.Nodes))
+	}
+
+	fmt.Printf("📡 Waking up nodes, waiting for %d of %d\n", quorum, len(cfg.Ceph.Nodes))
+
+	nodes, err := waitForNodes(cfg, newBootEnv(cfg), quorum)
+	defer func() {
+		for _, n := range nodes {
+			if n.sshClient != nil {
+				n.sshClient.Close()
 			}
-		case <-time.After(time.Minute):
-			return fmt.Errorf("timed out waiting for ssh")
 		}
+	}()
+	if err != nil {
+		return err
 	}
 
-	sshClient, err := ssh.New(node)
-	if err != nil {
-		return fmt.Errorf("ssh: %w", err)
+	var sshClient *ssh.Client
+	for _, n := range nodes {
+		if n.stage == bootStageDaemonsUp {
+			sshClient = n.sshClient
+			break
+		}
 	}
-	defer sshClient.Close()
 
 	fmt.Println("⏳ Waiting for cluster services to start")
 	seenServices := make(map[string]struct{})
-SERVICELOOP:
-	for {
-		select {
-		case <-time.Tick(time.Second):
-			services, err := sshClient.ListCephServices()
-			if err != nil {
-				return fmt.Errorf("list services: %w", err)
-			}
-
-			allRunning := true
-			for _, service := range services {
-				if service.Status.Running != service.Status.Size {
-					allRunning = false
-					continue
-				}
+	err = wait.PollWithTimeout(cfg.Ceph.ServicesWait, wait.DefaultBackoff, func(ctx context.Context) (bool, error) {
+		services, err := sshClient.ListCephServices()
+		if err != nil {
+			return false, fmt.Errorf("list services: %w", err)
+		}
 
-				_, seen := seenServices[service.Name]
-				if !seen {
-					fmt.Println(BrightBlack + " ↳ " + service.Name + Reset)
-					seenServices[service.Name] = struct{}{}
-				}
+		allRunning := true
+		for _, service := range services {
+			if service.Status.Running != service.Status.Size {
+				allRunning = false
+				continue
 			}
 
-			if allRunning {
-				break SERVICELOOP
+			_, seen := seenServices[service.Name]
+			if !seen {
+				fmt.Println(BrightBlack + " ↳ " + service.Name + Reset)
+				seenServices[service.Name] = struct{}{}
 			}
-		case <-time.After(time.Minute):
-			return fmt.Errorf("timed out waiting for services")
 		}
+
+		return allRunning, nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait for services: %w", err)
+	}
+
+	fmt.Println("⏳ Waiting for OSDs to come up")
+
+	// Only OSDs on nodes that have booted are expected to come up. The
+	// rest will join the cluster whenever their nodes are back.
+	var hosts []string
+	for _, n := range nodes {
+		if n.stage == bootStageDaemonsUp {
+			hosts = append(hosts, n.Name)
+		}
+	}
+
+	if err := waitForOSDsUp(sshClient, hosts, cfg.Ceph.ServicesWait); err != nil {
+		return fmt.Errorf("wait for osds: %w", err)
 	}
 
 	fmt.Println("🚩 Unsetting cluster-wide OSD flags")
@@ -107,50 +133,318 @@ SERVICELOOP:
 	// TODO: Bring the CephFS cluster back up
 
 	fmt.Println("⏳ Waiting for cluster to become healthy")
-HEALTHLOOP:
+	err = wait.PollWithTimeout(cfg.Ceph.HealthWait, wait.DefaultBackoff, func(ctx context.Context) (bool, error) {
+		health, err := sshClient.CephHealth()
+		if err != nil {
+			return false, fmt.Errorf("ceph health: %w", err)
+		}
+		return health == CephStatusHealthy, nil
+	})
+	if err != nil {
+		return fmt.Errorf("wait for health: %w", err)
+	}
+	fmt.Println(BrightBlack + " ↳ Cluster is healthy" + Reset)
+
+	fmt.Println("✅ All done!")
+
+	return nil
+}
+
+// wolResendInterval is how long to wait for a node to answer before
+// sending another Wake-on-LAN packet.
+const wolResendInterval = 15 * time.Second
+
+type bootStage int
+
+const (
+	bootStageWaking bootStage = iota
+	bootStageTCPUp
+	bootStageSSHReady
+	bootStageDaemonsUp
+)
+
+// bootNode tracks how far along a node is in the boot process.
+type bootNode struct {
+	config.Node
+
+	stage     bootStage
+	driver    string
+	packets   int
+	lastWake  time.Time
+	daemons   int
+	running   int
+	lastErr   error
+	sshClient *ssh.Client
+}
+
+// bootEnv is how boot stages reach the nodes. Tests replace it to walk
+// nodes through the stages without real hardware.
+type bootEnv struct {
+	power   func(node config.Node) (power.Driver, error)
+	dial    func(addr string) error
+	connect func(node config.Node) (*ssh.Client, error)
+	daemons func(client *ssh.Client, hostname string) ([]ssh.CephDaemon, error)
+	now     func() time.Time
+
+	// backoff controls how often stages are checked. Nodes take a while
+	// to boot, so there is no point in checking too often, but once they
+	// are up things move quickly.
+	backoff wait.Backoff
+}
+
+func newBootEnv(cfg *config.Config) bootEnv {
+	return bootEnv{
+		power: func(node config.Node) (power.Driver, error) {
+			return power.New(cfg, node)
+		},
+		dial: func(addr string) error {
+			conn, err := net.DialTimeout("tcp", addr, 300*time.Millisecond)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		},
+		connect: ssh.New,
+		daemons: (*ssh.Client).CephStatusByHost,
+		now:     time.Now,
+		backoff: wait.Backoff{
+			Initial: time.Second,
+			Max:     3 * time.Second,
+			Factor:  1.2,
+			Jitter:  0.1,
+		},
+	}
+}
+
+func (n *bootNode) String() string {
+	var b strings.Builder
+
+	b.WriteString(n.Name + ": ")
+
+	switch {
+	case n.driver == "":
+		b.WriteString("no power control")
+	case n.driver != "wol":
+		b.WriteString("powered on using " + n.driver)
+	case n.packets == 1:
+		b.WriteString("wol sent")
+	default:
+		b.WriteString(fmt.Sprintf("wol sent %dx", n.packets))
+	}
+
+	if n.stage >= bootStageTCPUp {
+		b.WriteString(", tcp up")
+	}
+
+	if n.stage >= bootStageSSHReady {
+		b.WriteString(", ssh ok")
+		if n.daemons > 0 {
+			b.WriteString(fmt.Sprintf(", %d/%d daemons up", n.running, n.daemons))
+		}
+	}
+
+	if n.stage == bootStageDaemonsUp {
+		b.WriteString(" ✅")
+	} else if n.lastErr != nil {
+		b.WriteString(" (" + n.lastErr.Error() + ")")
+	}
+
+	return b.String()
+}
+
+// waitForNodes wakes up all nodes in parallel and waits until at least
+// quorum of them are running all of their ceph daemons. Progress of every
+// node is shown on its own line.
+func waitForNodes(cfg *config.Config, env bootEnv, quorum int) ([]*bootNode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Ceph.SSHWait)
+	defer cancel()
+
+	var mu sync.Mutex
+
+	states := make([]*bootNode, 0, len(cfg.Ceph.Nodes))
+	for _, node := range cfg.Ceph.Nodes {
+		states = append(states, &bootNode{Node: node})
+	}
+
+	lines := live.New(os.Stdout, len(states))
+	render := func() {
+		mu.Lock()
+		for i, n := range states {
+			lines.Set(i, n.String())
+		}
+		mu.Unlock()
+		lines.Render()
+	}
+
+	var wg sync.WaitGroup
+	for _, n := range states {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bootNodeLoop(ctx, env, &mu, n)
+		}()
+	}
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-time.Tick(time.Second):
-			health, err := sshClient.CephHealth()
-			if err != nil {
-				return fmt.Errorf("ceph health: %w", err)
+		case <-ticker.C:
+			render()
+
+			mu.Lock()
+			up := 0
+			for _, n := range states {
+				if n.stage == bootStageDaemonsUp {
+					up++
+				}
 			}
+			mu.Unlock()
 
-			if health == CephStatusHealthy {
-				fmt.Println(BrightBlack + " ↳ Cluster is healthy" + Reset)
-				break HEALTHLOOP
+			if up >= quorum {
+				cancel()
+				wg.Wait()
+				render()
+				return states, nil
 			}
-		case <-time.After(time.Minute):
-			return fmt.Errorf("cluster is not healthy")
+		case <-ctx.Done():
+			wg.Wait()
+			render()
+			return states, fmt.Errorf("timed out waiting for %d nodes to boot", quorum)
 		}
 	}
+}
 
-	fmt.Println("✅ All done!")
+// bootNodeLoop walks a single node through boot stages until all of its
+// ceph daemons are running or the context is done.
+func bootNodeLoop(ctx context.Context, env bootEnv, mu *sync.Mutex, n *bootNode) {
+	// Nodes without power control are still waited for, as they might
+	// have been powered on by other means.
+	driver, err := env.power(n.Node)
 
-	return nil
+	mu.Lock()
+	n.lastErr = err
+	if driver != nil {
+		n.driver = driver.Name()
+	}
+	mu.Unlock()
+
+	// Errors are recorded on the node to show them to the operator and the
+	// loop only ends when the context is done.
+	_ = wait.Poll(ctx, env.backoff, func(ctx context.Context) (bool, error) {
+		return n.step(ctx, env, mu, driver), nil
+	})
 }
 
-func firstAvailable(nodes []config.Node) (config.Node, bool) {
-	timeout := 300 * time.Millisecond
+// step checks whether the node has reached the next boot stage and
+// reports whether all of its ceph daemons are running.
+func (n *bootNode) step(ctx context.Context, env bootEnv, mu *sync.Mutex, driver power.Driver) bool {
+	mu.Lock()
+	stage := n.stage
+	mu.Unlock()
 
-	c := make(chan config.Node)
-	checkSSH := func(node config.Node) {
-		conn, err := net.DialTimeout("tcp", node.Addr, timeout)
-		if err != nil {
-			return
+	switch stage {
+	case bootStageWaking:
+		// Magic packets are sent over UDP and can get lost, so keep
+		// resending them until the node answers. BMCs on the other hand
+		// acknowledge the request, so it is only sent once.
+		resend := driver != nil && driver.Name() == "wol" && env.now().Sub(n.lastWake) >= wolResendInterval
+		if driver != nil && (n.lastWake.IsZero() || resend) {
+			err := driver.On(ctx)
+
+			mu.Lock()
+			n.lastWake = env.now()
+			n.packets++
+			n.lastErr = err
+			mu.Unlock()
 		}
-		c <- node
-		conn.Close()
-	}
 
-	for _, node := range nodes {
-		go checkSSH(node)
+		if err := env.dial(n.Addr); err != nil {
+			return false
+		}
+
+		mu.Lock()
+		n.stage = bootStageTCPUp
+		mu.Unlock()
+
+	case bootStageTCPUp:
+		// Port may be open before sshd is ready to authenticate users.
+		client, err := env.connect(n.Node)
+
+		mu.Lock()
+		n.lastErr = err
+		if err == nil {
+			n.sshClient = client
+			n.stage = bootStageSSHReady
+		}
+		mu.Unlock()
+
+	case bootStageSSHReady:
+		// Orchestrator is not available until managers are up, so
+		// errors are expected for a while.
+		daemons, err := env.daemons(n.sshClient, n.Name)
+
+		running := 0
+		for _, daemon := range daemons {
+			if daemon.Status == ssh.DaemonStatusRunning {
+				running++
+			}
+		}
+
+		// Hosts without daemons, e.g. newly added ones, are up as soon as
+		// the orchestrator answers.
+		mu.Lock()
+		n.lastErr = err
+		n.daemons = len(daemons)
+		n.running = running
+		if err == nil && running == len(daemons) {
+			n.stage = bootStageDaemonsUp
+		}
+		mu.Unlock()
+
+	case bootStageDaemonsUp:
+		return true
 	}
 
-	select {
-	case n := <-c:
-		return n, true
-	case <-time.After(300 * time.Millisecond):
-		return config.Node{}, false
+	return false
+}
+
+// waitForOSDsUp waits until every OSD on the hosts is reported as up.
+func waitForOSDsUp(sshClient *ssh.Client, hosts []string, timeout time.Duration) error {
+	var lastProgress string
+
+	return wait.PollWithTimeout(timeout, wait.DefaultBackoff, func(ctx context.Context) (bool, error) {
+		tree, err := sshClient.CephOSDDfTree()
+		if err != nil {
+			return false, fmt.Errorf("osd df: %w", err)
+		}
+
+		up, expected := osdsUp(tree, hosts)
+
+		progress := fmt.Sprintf(" ↳ %d/%d OSDs up", up, expected)
+		if progress != lastProgress {
+			fmt.Println(BrightBlack + progress + Reset)
+			lastProgress = progress
+		}
+
+		return up == expected, nil
+	})
+}
+
+// osdsUp counts OSDs on the hosts, and how many of them are up.
+func osdsUp(tree *ssh.CephOSDTree, hosts []string) (up, expected int) {
+	osdHosts := tree.Hosts()
+
+	for _, osd := range tree.OSDs() {
+		if !slices.ContainsFunc(hosts, func(h string) bool { return strings.EqualFold(h, osdHosts[osd.ID]) }) {
+			continue
+		}
+		expected++
+		if osd.Status == "up" {
+			up++
+		}
 	}
+
+	return up, expected
 }
@@ -0,0 +1,246 @@
+package ceph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/power"
+	"github.com/romantomjak/labctl/ssh"
+	"github.com/romantomjak/labctl/wait"
+)
+
+// fakeDriver counts how many times nodes are powered on.
+type fakeDriver struct {
+	name string
+	ons  int
+}
+
+func (d *fakeDriver) Name() string                                { return d.name }
+func (d *fakeDriver) On(context.Context) error                    { d.ons++; return nil }
+func (d *fakeDriver) Off(context.Context, bool) error             { return nil }
+func (d *fakeDriver) Cycle(context.Context) error                 { return nil }
+func (d *fakeDriver) Status(context.Context) (power.State, error) { return "", nil }
+
+// fakeNodes stands in for nodes that are booting. Nodes answer once they
+// are up, have an ssh server once ready, and run the given daemons.
+type fakeNodes struct {
+	mu      sync.Mutex
+	up      map[string]bool
+	ready   map[string]bool
+	daemons map[string][]ssh.CephDaemon
+}
+
+func (f *fakeNodes) env(clock *time.Time) bootEnv {
+	return bootEnv{
+		power: func(node config.Node) (power.Driver, error) {
+			return &fakeDriver{name: "wol"}, nil
+		},
+		dial: func(addr string) error {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if !f.up[addr] {
+				return errors.New("connection refused")
+			}
+			return nil
+		},
+		connect: func(node config.Node) (*ssh.Client, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if !f.ready[node.Name] {
+				return nil, errors.New("ssh handshake failed")
+			}
+			return nil, nil
+		},
+		daemons: func(_ *ssh.Client, hostname string) ([]ssh.CephDaemon, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			daemons, ok := f.daemons[hostname]
+			if !ok {
+				return nil, errors.New("orchestrator is not available")
+			}
+			return daemons, nil
+		},
+		now:     func() time.Time { return *clock },
+		backoff: wait.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Factor: 2},
+	}
+}
+
+func running(types ...string) []ssh.CephDaemon {
+	var daemons []ssh.CephDaemon
+	for _, t := range types {
+		daemons = append(daemons, ssh.CephDaemon{Type: t, Status: ssh.DaemonStatusRunning})
+	}
+	return daemons
+}
+
+func TestBootNodeStages(t *testing.T) {
+	stopped := ssh.CephDaemon{Type: "osd", Status: 0}
+
+	tests := []struct {
+		name    string
+		daemons map[string][]ssh.CephDaemon
+		want    bootStage
+	}{
+		{"orchestrator not available", nil, bootStageSSHReady},
+		{"daemons starting", map[string][]ssh.CephDaemon{"ceph1": append(running("mon"), stopped)}, bootStageSSHReady},
+		{"daemons running", map[string][]ssh.CephDaemon{"ceph1": running("mon", "osd")}, bootStageDaemonsUp},
+		{"no daemons", map[string][]ssh.CephDaemon{"ceph1": {}}, bootStageDaemonsUp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := time.Now()
+			f := &fakeNodes{
+				up:      map[string]bool{"10.0.0.1:22": true},
+				ready:   map[string]bool{"ceph1": true},
+				daemons: tt.daemons,
+			}
+			env := f.env(&clock)
+
+			var mu sync.Mutex
+			n := &bootNode{Node: config.Node{Name: "ceph1", Addr: "10.0.0.1:22"}}
+			driver := &fakeDriver{name: "wol"}
+
+			// Every step moves the node at most one stage further.
+			for range 5 {
+				n.step(context.Background(), env, &mu, driver)
+			}
+
+			if n.stage != tt.want {
+				t.Errorf("node is in stage %d, want %d (%v)", n.stage, tt.want, n.lastErr)
+			}
+			if done := n.step(context.Background(), env, &mu, driver); done != (tt.want == bootStageDaemonsUp) {
+				t.Errorf("step reported done %v in stage %d", done, n.stage)
+			}
+		})
+	}
+}
+
+func TestBootNodeWake(t *testing.T) {
+	tests := []struct {
+		driver string
+		want   []int // power on requests after each step
+	}{
+		// Magic packets are resent until the node answers.
+		{"wol", []int{1, 1, 2, 2, 3}},
+		// BMCs acknowledge the request, so it is only sent once.
+		{"ipmi", []int{1, 1, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.driver, func(t *testing.T) {
+			clock := time.Now()
+			env := (&fakeNodes{}).env(&clock)
+
+			var mu sync.Mutex
+			n := &bootNode{Node: config.Node{Name: "ceph1", Addr: "10.0.0.1:22"}}
+			driver := &fakeDriver{name: tt.driver}
+
+			var got []int
+			for _, elapsed := range []time.Duration{0, wolResendInterval - time.Second, time.Second, wolResendInterval / 2, wolResendInterval / 2} {
+				clock = clock.Add(elapsed)
+				n.step(context.Background(), env, &mu, driver)
+				got = append(got, driver.ons)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("powered on %v times, want %v", got, tt.want)
+			}
+			if n.packets != driver.ons {
+				t.Errorf("node counted %d packets, driver got %d", n.packets, driver.ons)
+			}
+			if n.stage != bootStageWaking {
+				t.Errorf("node that doesn't answer is in stage %d", n.stage)
+			}
+		})
+	}
+}
+
+func TestWaitForNodesQuorum(t *testing.T) {
+	// ceph3 never answers.
+	f := &fakeNodes{
+		up:      map[string]bool{"10.0.0.1:22": true, "10.0.0.2:22": true},
+		ready:   map[string]bool{"ceph1": true, "ceph2": true},
+		daemons: map[string][]ssh.CephDaemon{"ceph1": running("mon", "osd"), "ceph2": {}},
+	}
+
+	cfg := &config.Config{}
+	cfg.Ceph.SSHWait = 2 * time.Second
+	cfg.Ceph.Nodes = []config.Node{
+		{Name: "ceph1", Addr: "10.0.0.1:22"},
+		{Name: "ceph2", Addr: "10.0.0.2:22"},
+		{Name: "ceph3", Addr: "10.0.0.3:22"},
+	}
+
+	tests := []struct {
+		quorum  int
+		wantErr bool
+	}{
+		{quorum: 2},
+		{quorum: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		clock := time.Now()
+		nodes, err := waitForNodes(cfg, f.env(&clock), tt.quorum)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("quorum %d: expected error", tt.quorum)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("quorum %d: %v", tt.quorum, err)
+		}
+
+		var up []string
+		for _, n := range nodes {
+			if n.stage == bootStageDaemonsUp {
+				up = append(up, n.Name)
+			}
+		}
+		if got := strings.Join(up, ","); got != "ceph1,ceph2" {
+			t.Errorf("quorum %d: nodes up are %s, want ceph1,ceph2", tt.quorum, got)
+		}
+	}
+}
+
+func TestOSDsUp(t *testing.T) {
+	// Trimmed output of `ceph osd df tree -f json`.
+	const treeJSON = `{"nodes": [
+		{"id": -1, "name": "default", "type": "root", "children": [-3, -5]},
+		{"id": -3, "name": "ceph1", "type": "host", "children": [0, 1]},
+		{"id": -5, "name": "ceph2", "type": "host", "children": [2]},
+		{"id": 0, "name": "osd.0", "type": "osd", "status": "up"},
+		{"id": 1, "name": "osd.1", "type": "osd", "status": "down"},
+		{"id": 2, "name": "osd.2", "type": "osd", "status": "down"}
+	]}`
+
+	var tree ssh.CephOSDTree
+	if err := json.Unmarshal([]byte(treeJSON), &tree); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hosts        []string
+		up, expected int
+	}{
+		{[]string{"ceph1"}, 1, 2},
+		{[]string{"CEPH1", "ceph2"}, 1, 3},
+		{[]string{"ceph3"}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		up, expected := osdsUp(&tree, tt.hosts)
+		if up != tt.up || expected != tt.expected {
+			t.Errorf("%v: %d/%d OSDs up, want %d/%d", tt.hosts, up, expected, tt.up, tt.expected)
+		}
+	}
+}
@@ -1,9 +1,29 @@
 package ceph
 
-import "github.com/spf13/cobra"
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/config"
+)
 
 var (
 	flagAssumeYes bool
+	flagForce     bool
+	flagForecast  bool
+
+	flagUpgradeRelease string
+	flagInstallVersion string
+	flagBootQuorum     int
+
+	flagSSHWait      time.Duration
+	flagServicesWait time.Duration
+	flagHealthWait   time.Duration
+	flagDaemonStop   time.Duration
+	flagPowerOffWait time.Duration
+	flagDrainWait    time.Duration
+	flagUpgradeWait  time.Duration
 )
 
 func Command() *cobra.Command {
@@ -12,17 +32,74 @@ func Command() *cobra.Command {
 		Short: "Interact with ceph cluster",
 	}
 
+	boot.Flags().IntVar(&flagBootQuorum, "quorum", 0, "number of nodes that must be up before continuing (default is all nodes)")
+	boot.Flags().DurationVar(&flagSSHWait, "ssh-wait", 0, "how long to wait for nodes to boot (overrides ssh_wait)")
+	boot.Flags().DurationVar(&flagServicesWait, "services-wait", 0, "how long to wait for services and OSDs to start (overrides services_wait)")
+	boot.Flags().DurationVar(&flagHealthWait, "health-wait", 0, "how long to wait for cluster to become healthy (overrides health_wait)")
 	cmd.AddCommand(boot)
 
 	poweroff.Flags().BoolVarP(&flagAssumeYes, "assume-yes", "y", false, `assume "yes" as answer to all prompts`)
+	poweroff.Flags().BoolVar(&flagForce, "force", false, "power off node even if OSD safety checks fail")
+	poweroff.Flags().DurationVar(&flagDaemonStop, "daemon-stop", 0, "how long to wait for each daemon to stop (overrides daemon_stop)")
+	poweroff.Flags().DurationVar(&flagPowerOffWait, "power-off-wait", 0, "how long to wait for each bmc to accept power off (overrides power_off_wait)")
 	cmd.AddCommand(poweroff)
 
+	enterMaintenance.Flags().BoolVar(&flagForce, "force", false, "enter maintenance even if OSD safety checks fail")
 	maintenance.AddCommand(enterMaintenance)
 	maintenance.AddCommand(exitMaintenance)
 	cmd.AddCommand(maintenance)
 
+	osd.AddCommand(osdList)
+	osd.AddCommand(osdOut)
+	osd.AddCommand(osdIn)
+	osd.AddCommand(osdReweight)
+	osdDrain.Flags().DurationVar(&flagDrainWait, "drain-wait", 0, "how long to wait for backfill to complete (overrides drain_wait)")
+	osd.AddCommand(osdDrain)
+	cmd.AddCommand(osd)
+
+	df.Flags().BoolVar(&flagForecast, "forecast", false, "estimate when the cluster will become full")
+	cmd.AddCommand(df)
+
+	upgrade.Flags().StringVar(&flagUpgradeRelease, "to", "", "ceph release to upgrade to")
+	upgrade.Flags().BoolVarP(&flagAssumeYes, "assume-yes", "y", false, `assume "yes" as answer to all prompts`)
+	upgrade.Flags().BoolVar(&flagForce, "force", false, "upgrade even if cluster is not healthy")
+	upgrade.Flags().DurationVar(&flagUpgradeWait, "upgrade-wait", 0, "how long to wait for upgrade to complete (overrides upgrade_wait)")
+	upgrade.MarkFlagRequired("to")
+	upgrade.AddCommand(upgradeStatus)
+	upgrade.AddCommand(upgradePause)
+	upgrade.AddCommand(upgradeResume)
+	upgrade.AddCommand(upgradeStop)
+	cmd.AddCommand(upgrade)
+
 	install.Flags().BoolVarP(&flagAssumeYes, "assume-yes", "y", false, `assume "yes" as answer to all prompts`)
+	install.Flags().StringVar(&flagInstallVersion, "version", "", "ceph release to install cephadm for (default is release from configuration)")
 	cmd.AddCommand(install)
 
 	return cmd
 }
+
+// applyTimeoutFlags overrides timeouts from the configuration file with
+// the ones given on the command line.
+func applyTimeoutFlags(cfg *config.Config) {
+	if flagSSHWait > 0 {
+		cfg.Ceph.SSHWait = flagSSHWait
+	}
+	if flagServicesWait > 0 {
+		cfg.Ceph.ServicesWait = flagServicesWait
+	}
+	if flagHealthWait > 0 {
+		cfg.Ceph.HealthWait = flagHealthWait
+	}
+	if flagDaemonStop > 0 {
+		cfg.Ceph.DaemonStop = flagDaemonStop
+	}
+	if flagPowerOffWait > 0 {
+		cfg.Ceph.PowerOffWait = flagPowerOffWait
+	}
+	if flagDrainWait > 0 {
+		cfg.Ceph.DrainWait = flagDrainWait
+	}
+	if flagUpgradeWait > 0 {
+		cfg.Ceph.UpgradeWait = flagUpgradeWait
+	}
+}
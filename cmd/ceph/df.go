@@ -0,0 +1,291 @@
+package ceph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/table"
+)
+
+// maxDfSamples caps the number of samples kept in the history file, which
+// is enough for a couple of years worth of daily samples.
+const maxDfSamples = 1000
+
+var dfExample = strings.Trim(`
+  # Show pool usage
+  labctl ceph df
+
+  # Estimate how many days are left until the cluster is full
+  labctl ceph df --forecast
+`, "\n")
+
+var df = &cobra.Command{
+	Use:          "df [flags]",
+	Short:        "Show pool usage and capacity",
+	Example:      dfExample,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         dfCommandFunc,
+}
+
+// dfSample is a point in time snapshot of cluster usage.
+type dfSample struct {
+	Time     time.Time               `json:"time"`
+	RawUsed  uint64                  `json:"raw_used"`
+	RawTotal uint64                  `json:"raw_total"`
+	Pools    map[string]dfPoolSample `json:"pools"`
+}
+
+type dfPoolSample struct {
+	Stored   uint64 `json:"stored"`
+	MaxAvail uint64 `json:"max_avail"`
+}
+
+func dfCommandFunc(cmd *cobra.Command, args []string) error {
+	sshClient, err := sshToRandomClusterNode()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	usage, err := sshClient.CephDf()
+	if err != nil {
+		return fmt.Errorf("df: %w", err)
+	}
+
+	pools, err := sshClient.ListCephPools()
+	if err != nil {
+		return fmt.Errorf("list pools: %w", err)
+	}
+
+	ratios, err := sshClient.CephFullRatios()
+	if err != nil {
+		return fmt.Errorf("full ratios: %w", err)
+	}
+
+	sample := dfSample{
+		Time:     time.Now().UTC(),
+		RawUsed:  usage.Stats.TotalUsedRawBytes,
+		RawTotal: usage.Stats.TotalBytes,
+		Pools:    make(map[string]dfPoolSample, len(usage.Pools)),
+	}
+	for _, pool := range usage.Pools {
+		sample.Pools[pool.Name] = dfPoolSample{
+			Stored:   pool.Stats.Stored,
+			MaxAvail: pool.Stats.MaxAvail,
+		}
+	}
+
+	historyFile, err := dfHistoryFile()
+	if err != nil {
+		return err
+	}
+
+	samples, err := recordDfSample(historyFile, sample)
+	if err != nil {
+		return fmt.Errorf("record sample: %w", err)
+	}
+
+	replicas := make(map[int]int, len(pools))
+	for _, pool := range pools {
+		replicas[pool.ID] = pool.Size
+	}
+
+	columns := []string{"POOL", "ID", "SIZE", "STORED", "USED", "MAX AVAIL", "%USED"}
+	if flagForecast {
+		columns = append(columns, "FULL IN")
+	}
+
+	t := table.New(columns...)
+	for _, pool := range usage.Pools {
+		row := []string{
+			pool.Name,
+			strconv.Itoa(pool.ID),
+			strconv.Itoa(replicas[pool.ID]),
+			humanize.IBytes(pool.Stats.Stored),
+			humanize.IBytes(pool.Stats.BytesUsed),
+			humanize.IBytes(pool.Stats.MaxAvail),
+			fmt.Sprintf("%.2f%%", pool.Stats.PercentUsed*100),
+		}
+
+		if flagForecast {
+			growth, ok := growthPerDay(samples, func(s dfSample) (uint64, bool) {
+				p, ok := s.Pools[pool.Name]
+				return p.Stored, ok
+			})
+			row = append(row, formatDaysUntilFull(float64(pool.Stats.MaxAvail), growth, ok))
+		}
+
+		t.AddRow(row...)
+	}
+	if err := t.Print(cmd.OutOrStdout()); err != nil {
+		return err
+	}
+
+	fmt.Println()
+
+	usedRatio := usage.Stats.TotalUsedRawRatio
+	fmt.Printf("💽 %s of %s raw capacity used (%.2f%%)\n",
+		humanize.IBytes(usage.Stats.TotalUsedRawBytes), humanize.IBytes(usage.Stats.TotalBytes), usedRatio*100)
+	fmt.Println(BrightBlack + fmt.Sprintf(" ↳ nearfull at %.0f%%, backfillfull at %.0f%%, full at %.0f%%",
+		ratios.NearFull*100, ratios.BackfillFull*100, ratios.Full*100) + Reset)
+
+	switch {
+	case usedRatio >= ratios.Full:
+		fmt.Println("🛑 Cluster is full, writes are blocked")
+	case usedRatio >= ratios.BackfillFull:
+		fmt.Println("🚨 Cluster is above backfillfull ratio, data will not be rebalanced")
+	case usedRatio >= ratios.NearFull:
+		fmt.Println("⚠️  Cluster is above nearfull ratio")
+	}
+
+	if !flagForecast {
+		return nil
+	}
+
+	growth, ok := growthPerDay(samples, func(s dfSample) (uint64, bool) {
+		return s.RawUsed, true
+	})
+	if !ok {
+		fmt.Printf("📈 Not enough samples to forecast, run this command again later (history is kept in %s)\n", historyFile)
+		return nil
+	}
+
+	untilFull := ratios.Full*float64(usage.Stats.TotalBytes) - float64(usage.Stats.TotalUsedRawBytes)
+	untilNearFull := ratios.NearFull*float64(usage.Stats.TotalBytes) - float64(usage.Stats.TotalUsedRawBytes)
+
+	fmt.Printf("📈 Raw usage is changing by %s per day based on %d samples\n", formatGrowth(growth), len(samples))
+	if untilNearFull > 0 {
+		fmt.Println(BrightBlack + " ↳ nearfull in " + formatDaysUntilFull(untilNearFull, growth, ok) + Reset)
+	}
+	fmt.Println(BrightBlack + " ↳ full in " + formatDaysUntilFull(untilFull, growth, ok) + Reset)
+
+	return nil
+}
+
+// dfHistoryFile returns the path of the file used to store usage samples.
+func dfHistoryFile() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("get home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "labctl", "ceph-df.json"), nil
+}
+
+// recordDfSample appends the sample to the history file and returns all
+// samples recorded so far, oldest first.
+func recordDfSample(filename string, sample dfSample) ([]dfSample, error) {
+	var samples []dfSample
+
+	b, err := os.ReadFile(filename)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// First sample, nothing to load.
+	case err != nil:
+		return nil, fmt.Errorf("read file: %w", err)
+	default:
+		if err := json.Unmarshal(b, &samples); err != nil {
+			return nil, fmt.Errorf("json: %w", err)
+		}
+	}
+
+	samples = append(samples, sample)
+	if len(samples) > maxDfSamples {
+		samples = samples[len(samples)-maxDfSamples:]
+	}
+
+	b, err = json.Marshal(samples)
+	if err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return nil, fmt.Errorf("create directory: %w", err)
+	}
+
+	// Write to a temporary file first so that an interrupted write can't
+	// corrupt the history.
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return nil, fmt.Errorf("write file: %w", err)
+	}
+
+	if err := os.Rename(tmp, filename); err != nil {
+		return nil, fmt.Errorf("rename file: %w", err)
+	}
+
+	return samples, nil
+}
+
+// growthPerDay fits a least squares line through the sampled values and
+// returns its slope in bytes per day. Second return value is false when
+// there are not enough samples to estimate the trend.
+func growthPerDay(samples []dfSample, value func(dfSample) (uint64, bool)) (float64, bool) {
+	var xs, ys []float64
+	for _, s := range samples {
+		v, ok := value(s)
+		if !ok {
+			continue
+		}
+		xs = append(xs, s.Time.Sub(samples[0].Time).Hours()/24)
+		ys = append(ys, float64(v))
+	}
+
+	n := float64(len(xs))
+	if n < 2 {
+		return 0, false
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, false // all samples were taken at the same time
+	}
+
+	return (n*sumXY - sumX*sumY) / denominator, true
+}
+
+func formatDaysUntilFull(remaining, growth float64, ok bool) string {
+	switch {
+	case !ok:
+		return "-"
+	case remaining <= 0:
+		return "now"
+	case growth <= 0:
+		return "never"
+	}
+
+	days := remaining / growth
+	if days > 3650 {
+		return "> 10 years"
+	}
+	return strconv.Itoa(int(math.Ceil(days))) + " days"
+}
+
+func formatGrowth(growth float64) string {
+	if growth < 0 {
+		return "-" + humanize.IBytes(uint64(-growth))
+	}
+	return "+" + humanize.IBytes(uint64(growth))
+}
@@ -2,23 +2,40 @@ package ceph
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/romantomjak/labctl/config"
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/config"
 )
 
+const defaultCephMirror = "https://download.ceph.com"
+
+var installExample = strings.Trim(`
+  # Install cephadm for the release in configuration file
+  labctl ceph install
+
+  # Install cephadm for a specific release
+  labctl ceph install --version 19.2.3
+`, "\n")
+
 var install = &cobra.Command{
 	Use:          "install",
 	Short:        "Install cephadm locally",
+	Example:      installExample,
 	Args:         cobra.NoArgs,
 	SilenceUsage: true,
 	RunE:         installCommandFunc,
@@ -30,11 +47,20 @@ func installCommandFunc(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("load configuration: %w", err)
 	}
 
-	if os.Geteuid() != 0 {
-		return fmt.Errorf("this command must be run with sudo")
+	release := cfg.Ceph.Release
+	if flagInstallVersion != "" {
+		release = strings.TrimPrefix(flagInstallVersion, "v")
 	}
 
-	filename := cfg.Ceph.Cephadm
+	// Release ends up in the download URL and picks the checksum.
+	if err := config.ValidateCephRelease(release); err != nil {
+		return err
+	}
+
+	filename, err := config.ExpandTilde(cfg.Ceph.Cephadm)
+	if err != nil {
+		return err
+	}
 
 	// Check if we need to prompt to overwrite existing file.
 	exists, err := fileExists(filename)
@@ -57,30 +83,123 @@ func installCommandFunc(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Open file for writing.
-	fout, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
-	if err != nil {
-		return fmt.Errorf("open file: %w", err)
+	mirror := cfg.Ceph.Mirror
+	if mirror == "" {
+		mirror = defaultCephMirror
 	}
-	defer fout.Close()
+	url := strings.TrimSuffix(mirror, "/") + "/rpm-" + release + "/el9/noarch/cephadm"
+
+	fmt.Printf("⌛️ Downloading cephadm %s\n", release)
+	fmt.Println(BrightBlack + " ↳ " + url + Reset)
 
-	// Chown the file with the user's UID/GID.
-	uid, err := strconv.ParseInt(os.Getenv("SUDO_UID"), 10, 64)
+	// Download into the same directory, so that the file can be atomically
+	// renamed once it has been verified. A failed download must never
+	// leave a truncated binary behind.
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".cephadm-*")
 	if err != nil {
-		return fmt.Errorf("parse sudo uid: %w", err)
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("%s is not writable, choose a different cephadm path or run with sudo", filepath.Dir(filename))
+		}
+		return fmt.Errorf("create temp file: %w", err)
 	}
-	gid, err := strconv.ParseInt(os.Getenv("SUDO_GID"), 10, 64)
-	if err != nil {
-		return fmt.Errorf("parse sudo gid: %w", err)
+	defer os.Remove(tmp.Name()) // no-op once the file has been renamed
+	defer tmp.Close()
+
+	client := httpClient()
+
+	hash := sha256.New()
+	if err := download(client, url, io.MultiWriter(tmp, hash)); err != nil {
+		return fmt.Errorf("download cephadm: %w", err)
 	}
 
-	if err := fout.Chown(int(uid), int(gid)); err != nil {
-		return fmt.Errorf("chown file: %w", err)
+	fmt.Println("🔍 Verifying download")
+
+	verified := false
+
+	if expected, ok := cfg.Ceph.CephadmSHA256[release]; ok {
+		checksum := hex.EncodeToString(hash.Sum(nil))
+		if !strings.EqualFold(checksum, expected) {
+			return fmt.Errorf("sha256 checksum mismatch: expected %s, got %s", expected, checksum)
+		}
+		fmt.Println(BrightBlack + " ↳ sha256 " + checksum + Reset)
+		verified = true
 	}
 
-	// Download binary.
-	url := "https://download.ceph.com/rpm-" + cfg.Ceph.Release + "/el9/noarch/cephadm"
+	if cfg.Ceph.CephadmSigningKey != "" {
+		signer, err := verifySignature(client, cfg.Ceph.CephadmSigningKey, url+".asc", tmp)
+		if err != nil {
+			return fmt.Errorf("verify signature: %w", err)
+		}
+		fmt.Println(BrightBlack + " ↳ signed by " + signer + Reset)
+		verified = true
+	}
+
+	if !verified {
+		// Checksums of other releases mean verification is expected, so
+		// a missing one is more likely an oversight than a choice.
+		if len(cfg.Ceph.CephadmSHA256) > 0 {
+			return fmt.Errorf("cephadm_sha256 has no checksum for %s", release)
+		}
+		fmt.Println("⚠️  Neither cephadm_sha256 nor cephadm_signing_key is configured, skipping verification")
+	}
 
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("sync file: %w", err)
+	}
+
+	if err := tmp.Chmod(0755); err != nil {
+		return fmt.Errorf("chmod file: %w", err)
+	}
+
+	// When running with sudo, hand the file over to the invoking user.
+	if os.Getenv("SUDO_UID") != "" && os.Getenv("SUDO_GID") != "" {
+		uid, err := strconv.Atoi(os.Getenv("SUDO_UID"))
+		if err != nil {
+			return fmt.Errorf("parse sudo uid: %w", err)
+		}
+		gid, err := strconv.Atoi(os.Getenv("SUDO_GID"))
+		if err != nil {
+			return fmt.Errorf("parse sudo gid: %w", err)
+		}
+
+		if err := tmp.Chown(uid, gid); err != nil {
+			return fmt.Errorf("chown file: %w", err)
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("rename file: %w", err)
+	}
+
+	fmt.Printf("✅ Installed at %s\n", filename)
+
+	return nil
+}
+
+func httpClient() *http.Client {
+	transport := &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout: 3 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 3 * time.Second,
+	}
+
+	// Allow mirrors on local or network mounted filesystems.
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   15 * time.Second,
+	}
+}
+
+// download writes the body of a successful response to w and verifies that
+// the whole body was received.
+func download(client *http.Client, url string, w io.Writer) error {
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return err
@@ -88,32 +207,72 @@ func installCommandFunc(cmd *cobra.Command, args []string) error {
 
 	req.Header.Set("User-Agent", "labctl (+https://github.com/romantomjak/labctl)")
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout: 3 * time.Second,
-			}).Dial,
-			TLSHandshakeTimeout: 3 * time.Second,
-		},
-		Timeout: 15 * time.Second,
-	}
-
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	_, err = io.Copy(fout, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	n, err := io.Copy(w, resp.Body)
 	if err != nil {
-		return fmt.Errorf("download cephadm: %w", err)
+		return err
 	}
 
-	fmt.Printf("✅ Installed at %s\n", filename)
+	if n == 0 {
+		return fmt.Errorf("empty response")
+	}
+
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return fmt.Errorf("incomplete download: got %d of %d bytes", n, resp.ContentLength)
+	}
 
 	return nil
 }
 
+// verifySignature checks the file against the detached signature using the
+// public key and returns the identity of the signer.
+func verifySignature(client *http.Client, keyFile, signatureURL string, f *os.File) (string, error) {
+	keyFile, err := config.ExpandTilde(keyFile)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := os.Open(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("open signing key: %w", err)
+	}
+	defer key.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(key)
+	if err != nil {
+		return "", fmt.Errorf("read signing key: %w", err)
+	}
+
+	var signature bytes.Buffer
+	if err := download(client, signatureURL, &signature); err != nil {
+		return "", fmt.Errorf("download signature: %w", err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("seek file: %w", err)
+	}
+
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, f, &signature, nil)
+	if err != nil {
+		return "", err
+	}
+
+	for name := range signer.Identities {
+		return name, nil
+	}
+
+	return fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint), nil
+}
+
 func fileExists(name string) (bool, error) {
 	_, err := os.Stat(name)
 	if err != nil {
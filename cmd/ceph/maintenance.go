@@ -62,6 +62,13 @@ func enterMaintenanceCommandFunc(cmd *cobra.Command, args []string) error {
 	}
 	defer sshClient.Close()
 
+	if err := checkOSDsSafeToStop(sshClient, host.Name); err != nil {
+		if !flagForce {
+			return fmt.Errorf("safety check: %w", err)
+		}
+		fmt.Printf("⚠️  Ignoring failed safety check: %s\n", err)
+	}
+
 	fmt.Printf("🚧 Placing %s into maintenance mode\n", host.Name)
 
 	if err := sshClient.CephEnterMaintenance(host.Name); err != nil {
@@ -111,7 +118,7 @@ func sshToRandomClusterNodeExcept(hostname string) (*ssh.Client, error) {
 
 			// We can return early if we don't need to filter hosts.
 			if hostname == "" {
-				return ssh.New(node)
+				return ssh.Get(node)
 			}
 
 			// Exclude hosts matching the filter.
@@ -119,7 +126,7 @@ func sshToRandomClusterNodeExcept(hostname string) (*ssh.Client, error) {
 				continue
 			}
 
-			return ssh.New(node)
+			return ssh.Get(node)
 		}
 
 	case n == 1:
@@ -129,7 +136,7 @@ func sshToRandomClusterNodeExcept(hostname string) (*ssh.Client, error) {
 			return nil, fmt.Errorf("only one host defined in configuration and it was excluded by hostname filter")
 		}
 
-		return ssh.New(node)
+		return ssh.Get(node)
 
 	default:
 		return nil, fmt.Errorf("no hosts defined in configuration")
@@ -0,0 +1,310 @@
+package ceph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/table"
+	"github.com/romantomjak/labctl/wait"
+)
+
+// longRunningBackoff is used when waiting on operations that take hours,
+// like backfilling data or upgrading the cluster.
+var longRunningBackoff = wait.Backoff{
+	Initial: 2 * time.Second,
+	Max:     30 * time.Second,
+	Factor:  1.5,
+	Jitter:  0.1,
+}
+
+var osdExample = strings.Trim(`
+  # List OSDs with their utilisation
+  labctl ceph osd ls
+
+  # Stop assigning data to osd.3
+  labctl ceph osd out 3
+
+  # Move all data off OSDs on ceph2 and wait for backfill to complete
+  labctl ceph osd drain ceph2
+`, "\n")
+
+var osd = &cobra.Command{
+	Use:          "osd [command]",
+	Short:        "OSD management commands",
+	Example:      osdExample,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+var osdList = &cobra.Command{
+	Use:          "ls",
+	Short:        "List OSDs",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         osdListCommandFunc,
+}
+
+var osdOut = &cobra.Command{
+	Use:          "out [flags] <osd>...",
+	Short:        "Mark OSDs out",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         osdOutCommandFunc,
+}
+
+var osdIn = &cobra.Command{
+	Use:          "in [flags] <osd>...",
+	Short:        "Mark OSDs in",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         osdInCommandFunc,
+}
+
+var osdReweight = &cobra.Command{
+	Use:          "reweight [flags] <osd> <weight>",
+	Short:        "Override OSD weight",
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+	RunE:         osdReweightCommandFunc,
+}
+
+var osdDrain = &cobra.Command{
+	Use:          "drain [flags] <host>",
+	Short:        "Move all data off OSDs on host",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         osdDrainCommandFunc,
+}
+
+func osdListCommandFunc(cmd *cobra.Command, args []string) error {
+	sshClient, err := sshToRandomClusterNode()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	tree, err := sshClient.CephOSDDfTree()
+	if err != nil {
+		return fmt.Errorf("osd df: %w", err)
+	}
+
+	osds := tree.OSDs()
+	if len(osds) == 0 {
+		fmt.Println("No OSDs found in the cluster 🙅‍♀️")
+		return nil
+	}
+
+	hosts := tree.Hosts()
+
+	t := table.New("ID", "HOST", "CLASS", "SIZE", "USE", "PGS", "STATUS", "REWEIGHT")
+	for _, osd := range osds {
+		state := "out"
+		if osd.In() {
+			state = "in"
+		}
+
+		t.AddRow(
+			osd.Name,
+			hosts[osd.ID],
+			osd.DeviceClass,
+			humanize.IBytes(osd.KB*1024),
+			fmt.Sprintf("%.2f%%", osd.Utilization),
+			strconv.Itoa(osd.PGs),
+			osd.Status+"/"+state,
+			strconv.FormatFloat(osd.Reweight, 'f', 2, 64),
+		)
+	}
+
+	return t.Print(cmd.OutOrStdout())
+}
+
+func osdOutCommandFunc(cmd *cobra.Command, args []string) error {
+	ids, err := parseOSDIDs(args)
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := sshToRandomClusterNode()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	fmt.Printf("🚚 Marking %s out\n", osdNames(ids))
+
+	if err := sshClient.CephOSDOut(ids); err != nil {
+		return fmt.Errorf("osd out: %w", err)
+	}
+
+	fmt.Println("✅ OK")
+
+	return nil
+}
+
+func osdInCommandFunc(cmd *cobra.Command, args []string) error {
+	ids, err := parseOSDIDs(args)
+	if err != nil {
+		return err
+	}
+
+	sshClient, err := sshToRandomClusterNode()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	fmt.Printf("📥 Marking %s in\n", osdNames(ids))
+
+	if err := sshClient.CephOSDIn(ids); err != nil {
+		return fmt.Errorf("osd in: %w", err)
+	}
+
+	fmt.Println("✅ OK")
+
+	return nil
+}
+
+func osdReweightCommandFunc(cmd *cobra.Command, args []string) error {
+	ids, err := parseOSDIDs(args[:1])
+	if err != nil {
+		return err
+	}
+
+	weight, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return fmt.Errorf("parse weight: %w", err)
+	}
+
+	if weight < 0 || weight > 1 {
+		return fmt.Errorf("weight must be between 0 and 1")
+	}
+
+	sshClient, err := sshToRandomClusterNode()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	fmt.Printf("⚖️  Reweighting %s to %s\n", osdNames(ids), args[1])
+
+	if err := sshClient.CephOSDReweight(ids[0], weight); err != nil {
+		return fmt.Errorf("osd reweight: %w", err)
+	}
+
+	fmt.Println("✅ OK")
+
+	return nil
+}
+
+func osdDrainCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	applyTimeoutFlags(cfg)
+
+	host, err := loadHostConfiguration(args[0])
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	fmt.Println("🔒 Connecting to cluster")
+
+	sshClient, err := sshToRandomClusterNodeExcept(host.Name)
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	ids, err := sshClient.CephOSDsByHost(host.Name)
+	if err != nil {
+		return fmt.Errorf("list osds: %w", err)
+	}
+
+	if len(ids) == 0 {
+		fmt.Printf("No OSDs found on %s 🙅‍♀️\n", host.Name)
+		return nil
+	}
+
+	fmt.Printf("🚚 Marking OSDs on %s out\n", host.Name)
+	fmt.Println(BrightBlack + " ↳ " + osdNames(ids) + Reset)
+
+	if err := sshClient.CephOSDOut(ids); err != nil {
+		return fmt.Errorf("osd out: %w", err)
+	}
+
+	fmt.Println("⏳ Waiting for backfill to complete")
+
+	// Backfill can take hours. If it times out, or the operator interrupts
+	// the command, data continues to move regardless.
+	var lastProgress string
+	err = wait.PollWithTimeout(cfg.Ceph.DrainWait, longRunningBackoff, func(ctx context.Context) (bool, error) {
+		pgs, err := sshClient.ListCephPGs()
+		if err != nil {
+			return false, fmt.Errorf("list pgs: %w", err)
+		}
+
+		// Only placement groups on the drained OSDs matter, the rest of the
+		// cluster may be scrubbing or recovering for unrelated reasons.
+		remaining := 0
+		for _, pg := range pgs {
+			if pg.OnOSDs(ids) {
+				remaining++
+			}
+		}
+
+		if remaining == 0 {
+			return true, nil
+		}
+
+		status, err := sshClient.CephStatus()
+		if err != nil {
+			return false, fmt.Errorf("ceph status: %w", err)
+		}
+
+		progress := fmt.Sprintf(" ↳ %d PGs left, %d/%d PGs active+clean, %.2f%% objects misplaced",
+			remaining, status.ActiveCleanPGs(), status.PGMap.NumPGs, status.PGMap.MisplacedRatio*100)
+
+		// Only print progress when it has changed to avoid flooding the
+		// terminal while a large backfill is running.
+		if progress != lastProgress {
+			fmt.Println(BrightBlack + progress + Reset)
+			lastProgress = progress
+		}
+
+		return false, nil
+	})
+	if errors.Is(err, wait.ErrTimeout) {
+		return fmt.Errorf("backfill did not complete within %s, data continues to move in the background", cfg.Ceph.DrainWait)
+	}
+	if err != nil {
+		return fmt.Errorf("wait for backfill: %w", err)
+	}
+
+	fmt.Printf("✅ %s drained, OSDs can be safely removed\n", host.Name)
+
+	return nil
+}
+
+// parseOSDIDs accepts OSDs given either as numeric IDs or as daemon
+// names, e.g. "3" or "osd.3".
+func parseOSDIDs(args []string) ([]int, error) {
+	ids := make([]int, 0, len(args))
+	for _, arg := range args {
+		id, err := strconv.Atoi(strings.TrimPrefix(arg, "osd."))
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("%q is not a valid OSD", arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -2,13 +2,18 @@ package ceph
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/live"
+	"github.com/romantomjak/labctl/power"
 	"github.com/romantomjak/labctl/ssh"
 )
 
@@ -23,6 +28,9 @@ var poweroffExample = strings.Trim(`
   # Power off a specific node
   labctl ceph poweroff <node>
 
+  # Power off a node even if stopping its OSDs would make data unavailable
+  labctl ceph poweroff --force <node>
+
   # Shutdown the whole cluster
   labctl ceph poweroff
 `, "\n")
@@ -49,6 +57,8 @@ func poweroffCluster() error {
 		return fmt.Errorf("load configuration: %w", err)
 	}
 
+	applyTimeoutFlags(cfg)
+
 	// Confirm if the operator really wants to shut down the whole cluster.
 	if !flagAssumeYes {
 		fmt.Fprint(os.Stdout, "❓ Shut down the whole cluster? (y/n) [n] ")
@@ -105,7 +115,7 @@ func poweroffCluster() error {
 
 	fmt.Println("💥 Stopping crash service")
 
-	if err := sshClient.StopCephService("crash"); err != nil {
+	if err := stopCephService(sshClient, "crash", cfg.Ceph.DaemonStop); err != nil {
 		return fmt.Errorf("stop service: %w", err)
 	}
 
@@ -118,9 +128,7 @@ func poweroffCluster() error {
 	for _, daemon := range daemons {
 		name := daemon.Type + "." + daemon.ID
 
-		fmt.Println(BrightBlack + " ↳ " + name + Reset)
-
-		if err := sshClient.StopCephDaemon(name); err != nil {
+		if err := stopCephDaemon(sshClient, name, cfg.Ceph.DaemonStop); err != nil {
 			return fmt.Errorf("stop daemon: %w", err)
 		}
 	}
@@ -149,11 +157,10 @@ func poweroffCluster() error {
 
 			// Monitors can't be stopped using ceph orchestrator, so we must
 			// ssh into the nodes and stop them using their systemd service.
-			nodeSSHClient, err := ssh.New(node)
+			nodeSSHClient, err := ssh.Get(node)
 			if err != nil {
 				return fmt.Errorf("ssh: %w", err)
 			}
-			defer nodeSSHClient.Close()
 
 			if err := nodeSSHClient.StopSystemdService(fmt.Sprintf("ceph-%s@%s", fsid, name)); err != nil {
 				return fmt.Errorf("stop service: %w", err)
@@ -164,14 +171,8 @@ func poweroffCluster() error {
 	fmt.Println("⚡️ Scheduling power off")
 
 	for _, node := range cfg.Ceph.Nodes {
-		nodeSSHClient, err := ssh.New(node)
-		if err != nil {
-			return fmt.Errorf("ssh: %w", err)
-		}
-		defer nodeSSHClient.Close()
-
-		if err := nodeSSHClient.Shutdown(); err != nil {
-			return fmt.Errorf("shutdown: %w", err)
+		if err := powerOffNode(cfg, node); err != nil {
+			return err
 		}
 	}
 
@@ -181,6 +182,13 @@ func poweroffCluster() error {
 }
 
 func poweroffNode(hostname string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	applyTimeoutFlags(cfg)
+
 	host, err := loadHostConfiguration(hostname)
 	if err != nil {
 		return fmt.Errorf("load configuration: %w", err)
@@ -188,7 +196,8 @@ func poweroffNode(hostname string) error {
 
 	fmt.Println("🔒 Connecting to cluster")
 
-	sshClient, err := ssh.New(host)
+	// Connection is shared, so that it is reused to shut the node down.
+	sshClient, err := ssh.Get(host)
 	if err != nil {
 		return fmt.Errorf("ssh: %w", err)
 	}
@@ -207,10 +216,19 @@ func poweroffNode(hostname string) error {
 
 	fmt.Println(BrightBlack + " ↳ in maintenance mode" + Reset)
 
+	// Cluster may have changed since the host entered maintenance, e.g.
+	// another host went down, or the host entered it with --force.
+	if err := checkOSDsSafeToStop(sshClient, host.Name); err != nil {
+		if !flagForce {
+			return fmt.Errorf("safety check: %w", err)
+		}
+		fmt.Printf("⚠️  Ignoring failed safety check: %s\n", err)
+	}
+
 	fmt.Println("⚡️ Scheduling power off")
 
-	if err := sshClient.Shutdown(); err != nil {
-		return fmt.Errorf("shutdown: %w", err)
+	if err := powerOffNode(cfg, host); err != nil {
+		return err
 	}
 
 	fmt.Println("✅ OK")
@@ -218,6 +236,70 @@ func poweroffNode(hostname string) error {
 	return nil
 }
 
+// powerOffNode asks the operating system of the node to shut down. BMC is
+// used if the node has one that can power it off, which works even when
+// the node is no longer reachable over SSH.
+func powerOffNode(cfg *config.Config, node config.Node) error {
+	if node.BMC != nil {
+		fmt.Println(BrightBlack + " ↳ " + node.Name + " using " + node.BMC.Driver + Reset)
+
+		err := powerOffWithBMC(cfg, node)
+		if !errors.Is(err, power.ErrNotSupported) {
+			if err != nil {
+				return fmt.Errorf("power off: %w", err)
+			}
+			return nil
+		}
+
+		fmt.Println(BrightBlack + " ↳ " + node.BMC.Driver + " can't power off " + node.Name + ", using ssh" + Reset)
+	} else {
+		fmt.Println(BrightBlack + " ↳ " + node.Name + Reset)
+	}
+
+	// Connections opened earlier, e.g. while stopping monitors, are reused.
+	sshClient, err := ssh.Get(node)
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+
+	return sshClient.Shutdown()
+}
+
+func powerOffWithBMC(cfg *config.Config, node config.Node) error {
+	driver, err := power.New(cfg, node)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Ceph.PowerOffWait)
+	defer cancel()
+
+	return driver.Off(ctx, false)
+}
+
+func stopCephService(sshClient *ssh.Client, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return sshClient.StopCephService(ctx, name, stopProgress(name))
+}
+
+func stopCephDaemon(sshClient *ssh.Client, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return sshClient.StopCephDaemon(ctx, name, stopProgress(name))
+}
+
+// stopProgress shows how many daemons have stopped so far, indented
+// under the step header.
+func stopProgress(name string) ssh.StopProgressFunc {
+	line := live.NewLine(os.Stdout)
+	return func(stopped, total int) {
+		line.Update(fmt.Sprintf("%s: %d/%d daemons stopped", name, stopped, total))
+	}
+}
+
 func sshToRandomClusterNode() (*ssh.Client, error) {
 	return sshToRandomClusterNodeExcept("")
 }
@@ -0,0 +1,160 @@
+package ceph
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/romantomjak/labctl/ssh"
+)
+
+// crushItemNone is used in acting sets of erasure coded pools to mark
+// shards that don't have an OSD assigned.
+const crushItemNone = 2147483647
+
+// inactivePG describes a placement group that would become inactive if
+// the OSDs were stopped.
+type inactivePG struct {
+	ID        string
+	Pool      string
+	Remaining int
+	MinSize   int
+}
+
+// checkOSDsSafeToStop verifies that stopping every OSD on the host won't
+// make placement groups inactive. Operator is given a detailed explanation
+// of which PGs are affected when the check fails.
+func checkOSDsSafeToStop(sshClient *ssh.Client, hostname string) error {
+	fmt.Println("🛡️  Checking OSDs are safe to stop")
+
+	ids, err := sshClient.CephOSDsByHost(hostname)
+	if err != nil {
+		return fmt.Errorf("list osds: %w", err)
+	}
+
+	if len(ids) == 0 {
+		fmt.Println(BrightBlack + " ↳ No OSDs on " + hostname + Reset)
+		return nil
+	}
+
+	fmt.Println(BrightBlack + " ↳ " + osdNames(ids) + " on " + hostname + Reset)
+
+	okToStop, err := sshClient.CephOSDOkToStop(ids)
+	if err != nil {
+		return fmt.Errorf("ok to stop: %w", err)
+	}
+
+	safeToDestroy, err := sshClient.CephOSDSafeToDestroy(ids)
+	if err != nil {
+		return fmt.Errorf("safe to destroy: %w", err)
+	}
+
+	// Having PGs stored on the OSDs is expected during maintenance, so
+	// this is only reported to give the operator the full picture.
+	if len(safeToDestroy.StoredPGs) > 0 {
+		fmt.Println(BrightBlack + " ↳ " + osdNames(safeToDestroy.StoredPGs) + " still store data and are not safe to destroy" + Reset)
+	}
+
+	pools, err := sshClient.ListCephPools()
+	if err != nil {
+		return fmt.Errorf("list pools: %w", err)
+	}
+
+	pgs, err := sshClient.ListCephPGs()
+	if err != nil {
+		return fmt.Errorf("list pgs: %w", err)
+	}
+
+	inactive, err := inactivePGs(okToStop, pools, pgs, ids)
+	if err != nil {
+		return err
+	}
+
+	if okToStop.OkToStop && len(inactive) == 0 {
+		fmt.Println(BrightBlack + fmt.Sprintf(" ↳ OK to stop, %d PGs would become degraded", len(okToStop.OkBecomeDegraded)) + Reset)
+		return nil
+	}
+
+	for _, pg := range inactive {
+		if pg.Pool == "" {
+			fmt.Println(BrightBlack + " ↳ pg " + pg.ID + " would become inactive" + Reset)
+			continue
+		}
+		fmt.Println(BrightBlack + fmt.Sprintf(" ↳ pg %s in pool %s would be left with %d replica(s), min_size is %d", pg.ID, pg.Pool, pg.Remaining, pg.MinSize) + Reset)
+	}
+
+	if len(inactive) == 0 {
+		return fmt.Errorf("ceph reports %s are not ok to stop", osdNames(ids))
+	}
+
+	return fmt.Errorf("stopping %s would make %d placement group(s) inactive", osdNames(ids), len(inactive))
+}
+
+// inactivePGs returns placement groups that would become inactive if the
+// OSDs were stopped, either because ok-to-stop says so or because they
+// would be left with fewer replicas than their pool's min_size.
+func inactivePGs(okToStop *ssh.CephOSDOkToStop, pools []ssh.CephPool, pgs []ssh.CephPG, ids []int) ([]inactivePG, error) {
+	inactive, err := pgsBelowMinSize(pools, pgs, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// ok-to-stop may know about PGs that are not reflected in the acting
+	// sets yet, e.g. those that are already degraded or peering.
+	for _, id := range okToStop.BadBecomeInactive {
+		if !slices.ContainsFunc(inactive, func(pg inactivePG) bool { return pg.ID == id }) {
+			inactive = append(inactive, inactivePG{ID: id})
+		}
+	}
+
+	return inactive, nil
+}
+
+// pgsBelowMinSize returns placement groups that would be left with fewer
+// replicas than their pool's min_size if the OSDs were stopped.
+func pgsBelowMinSize(pools []ssh.CephPool, pgs []ssh.CephPG, ids []int) ([]inactivePG, error) {
+	poolsByID := make(map[int]ssh.CephPool, len(pools))
+	for _, pool := range pools {
+		poolsByID[pool.ID] = pool
+	}
+
+	var inactive []inactivePG
+	for _, pg := range pgs {
+		poolID, err := pg.PoolID()
+		if err != nil {
+			return nil, err
+		}
+
+		pool, ok := poolsByID[poolID]
+		if !ok {
+			continue // pool was removed while we were looking
+		}
+
+		remaining := 0
+		for _, osd := range pg.Acting {
+			if osd != crushItemNone && !slices.Contains(ids, osd) {
+				remaining++
+			}
+		}
+
+		if remaining < pool.MinSize {
+			inactive = append(inactive, inactivePG{
+				ID:        pg.ID,
+				Pool:      pool.Name,
+				Remaining: remaining,
+				MinSize:   pool.MinSize,
+			})
+		}
+	}
+
+	return inactive, nil
+}
+
+func osdNames(ids []int) string {
+	names := make([]string, 0, len(ids))
+	for _, id := range ids {
+		names = append(names, "osd."+strconv.Itoa(id))
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,110 @@
+package ceph
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/romantomjak/labctl/ssh"
+)
+
+// poolsJSON is trimmed output of `ceph osd pool ls detail -f json` for a
+// replicated pool with size 3, a replicated pool with size 2 and an
+// erasure coded pool with k=2, m=1.
+const poolsJSON = `[
+	{"pool_id": 1, "pool_name": ".mgr", "type": 1, "size": 3, "min_size": 2, "crush_rule": 0},
+	{"pool_id": 2, "pool_name": "scratch", "type": 1, "size": 2, "min_size": 2, "crush_rule": 0},
+	{"pool_id": 3, "pool_name": "ec", "type": 3, "size": 3, "min_size": 2, "crush_rule": 1}
+]`
+
+// pgsJSON is trimmed output of `ceph pg dump pgs_brief -f json`. OSDs 0
+// and 1 are on one host, OSDs 2 and 3 on another and OSD 4 on a third.
+const pgsJSON = `{"pg_ready": true, "pg_stats": [
+	{"pgid": "1.0", "state": "active+clean", "up": [0, 2, 4], "up_primary": 0, "acting": [0, 2, 4], "acting_primary": 0},
+	{"pgid": "1.1", "state": "active+undersized+degraded", "up": [2, 4], "up_primary": 2, "acting": [2, 4], "acting_primary": 2},
+	{"pgid": "2.0", "state": "active+clean", "up": [1, 3], "up_primary": 1, "acting": [1, 3], "acting_primary": 1},
+	{"pgid": "2.1", "state": "active+clean", "up": [4, 0], "up_primary": 4, "acting": [4, 0], "acting_primary": 4},
+	{"pgid": "3.0", "state": "active+clean", "up": [3, 1, 4], "up_primary": 3, "acting": [3, 1, 4], "acting_primary": 3},
+	{"pgid": "3.1", "state": "active+undersized+degraded", "up": [2, 2147483647, 4], "up_primary": 2, "acting": [2, 2147483647, 4], "acting_primary": 2},
+	{"pgid": "9.0", "state": "active+clean", "up": [2, 3], "up_primary": 2, "acting": [2, 3], "acting_primary": 2}
+]}`
+
+func TestInactivePGs(t *testing.T) {
+	var pools []ssh.CephPool
+	if err := json.Unmarshal([]byte(poolsJSON), &pools); err != nil {
+		t.Fatal(err)
+	}
+	var dump struct {
+		PGStats []ssh.CephPG `json:"pg_stats"`
+	}
+	if err := json.Unmarshal([]byte(pgsJSON), &dump); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		okToStop string
+		ids      []int
+		want     []inactivePG
+	}{
+		{
+			// Pools with size 2 and min_size 2 go inactive with any OSD down,
+			// even when ok-to-stop doesn't say so.
+			name:     "below min_size",
+			okToStop: `{"ok_to_stop": true, "osds": [0, 1], "num_ok_pgs": 5, "num_not_ok_pgs": 0, "ok_become_degraded": ["1.0", "1.1", "2.1", "3.0", "3.1"]}`,
+			ids:      []int{0, 1},
+			want: []inactivePG{
+				{ID: "2.0", Pool: "scratch", Remaining: 1, MinSize: 2},
+				{ID: "2.1", Pool: "scratch", Remaining: 1, MinSize: 2},
+			},
+		},
+		{
+			// Degraded PGs only have two replicas left, and EC shards that
+			// have no OSD don't count towards min_size.
+			name:     "already degraded",
+			okToStop: `{"ok_to_stop": false, "osds": [2, 3], "num_ok_pgs": 1, "num_not_ok_pgs": 3, "bad_become_inactive": ["1.1", "2.0", "3.1"]}`,
+			ids:      []int{2, 3},
+			want: []inactivePG{
+				{ID: "1.1", Pool: ".mgr", Remaining: 1, MinSize: 2},
+				{ID: "2.0", Pool: "scratch", Remaining: 1, MinSize: 2},
+				{ID: "3.1", Pool: "ec", Remaining: 1, MinSize: 2},
+			},
+		},
+		{
+			// ok-to-stop may know about PGs that acting sets don't show yet.
+			name:     "reported by ok-to-stop only",
+			okToStop: `{"ok_to_stop": false, "osds": [5], "num_ok_pgs": 0, "num_not_ok_pgs": 1, "bad_become_inactive": ["1.3"]}`,
+			ids:      []int{5},
+			want:     []inactivePG{{ID: "1.3"}},
+		},
+		{
+			name:     "ok to stop",
+			okToStop: `{"ok_to_stop": true, "osds": [5], "num_ok_pgs": 0, "num_not_ok_pgs": 0}`,
+			ids:      []int{5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var okToStop ssh.CephOSDOkToStop
+			if err := json.Unmarshal([]byte(tt.okToStop), &okToStop); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := inactivePGs(&okToStop, pools, dump.PGStats, tt.ids)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPGsBelowMinSizeInvalidPG(t *testing.T) {
+	pgs := []ssh.CephPG{{ID: "garbage", Acting: []int{0}}}
+	if _, err := pgsBelowMinSize(nil, pgs, []int{0}); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,312 @@
+package ceph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/ssh"
+	"github.com/romantomjak/labctl/wait"
+)
+
+var upgradeExample = strings.Trim(`
+  # Upgrade cluster to a new release
+  labctl ceph upgrade --to 19.2.3
+
+  # Check how the upgrade is going
+  labctl ceph upgrade status
+
+  # Temporarily stop upgrading daemons
+  labctl ceph upgrade pause
+`, "\n")
+
+var upgrade = &cobra.Command{
+	Use:          "upgrade [flags]",
+	Short:        "Upgrade ceph cluster",
+	Example:      upgradeExample,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         upgradeCommandFunc,
+}
+
+var upgradeStatus = &cobra.Command{
+	Use:          "status",
+	Short:        "Show upgrade progress",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         upgradeStatusCommandFunc,
+}
+
+var upgradePause = &cobra.Command{
+	Use:          "pause",
+	Short:        "Pause upgrade in progress",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return upgradeControl("⏸️  Pausing upgrade", (*ssh.Client).CephUpgradePause)
+	},
+}
+
+var upgradeResume = &cobra.Command{
+	Use:          "resume",
+	Short:        "Resume paused upgrade",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return upgradeControl("▶️  Resuming upgrade", (*ssh.Client).CephUpgradeResume)
+	},
+}
+
+var upgradeStop = &cobra.Command{
+	Use:          "stop",
+	Short:        "Stop upgrade in progress",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return upgradeControl("🛑 Stopping upgrade", (*ssh.Client).CephUpgradeStop)
+	},
+}
+
+func upgradeCommandFunc(cmd *cobra.Command, args []string) error {
+	release := strings.TrimPrefix(flagUpgradeRelease, "v")
+	if err := config.ValidateCephRelease(release); err != nil {
+		return err
+	}
+
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	applyTimeoutFlags(cfg)
+
+	fmt.Println("🔒 Connecting to cluster")
+
+	sshClient, err := sshToRandomClusterNode()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	fmt.Println("⛑️  Checking cluster health")
+
+	health, err := sshClient.CephHealth()
+	if err != nil {
+		return fmt.Errorf("ceph health: %w", err)
+	}
+	if health != CephStatusHealthy {
+		if !flagForce {
+			return fmt.Errorf("cluster is not healthy")
+		}
+		fmt.Println("⚠️  Ignoring cluster health: " + health)
+	} else {
+		fmt.Println(BrightBlack + " ↳ Cluster is healthy" + Reset)
+	}
+
+	fmt.Printf("🔍 Checking %s image\n", release)
+
+	check, err := sshClient.CephUpgradeCheck(release)
+	if err != nil {
+		return fmt.Errorf("upgrade check: %w", err)
+	}
+
+	fmt.Println(BrightBlack + " ↳ " + check.TargetName + Reset)
+
+	if len(check.NeedsUpdate) == 0 {
+		fmt.Printf("✅ All daemons are already running %s\n", release)
+		return updateRelease(release)
+	}
+
+	fmt.Println(BrightBlack + fmt.Sprintf(" ↳ %d daemons need to be upgraded", len(check.NeedsUpdate)) + Reset)
+
+	if !flagAssumeYes {
+		answer, err := prompt(fmt.Sprintf("❓ Upgrade cluster to %s? (y/n) [n] ", release))
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			break // continue
+		default:
+			fmt.Println("🙅‍♀️ Not upgrading the cluster")
+			return nil
+		}
+	}
+
+	fmt.Println("🚀 Starting upgrade")
+
+	if err := sshClient.CephUpgradeStart(release); err != nil {
+		return fmt.Errorf("upgrade start: %w", err)
+	}
+
+	fmt.Println("⏳ Waiting for upgrade to complete")
+	fmt.Println(BrightBlack + " ↳ Press Ctrl+C to stop watching, upgrade will continue in the background" + Reset)
+
+	var lastProgress string
+	err = wait.PollWithTimeout(cfg.Ceph.UpgradeWait, longRunningBackoff, func(ctx context.Context) (bool, error) {
+		status, err := sshClient.CephUpgradeStatus()
+		if err != nil {
+			return false, fmt.Errorf("upgrade status: %w", err)
+		}
+
+		if !status.InProgress {
+			return true, nil
+		}
+
+		versions, err := sshClient.CephVersions()
+		if err != nil {
+			return false, fmt.Errorf("versions: %w", err)
+		}
+
+		progress := " ↳ " + formatUpgradeProgress(versions, release)
+		if status.IsPaused {
+			progress += " (paused)"
+		}
+		if status.Message != "" {
+			progress += " - " + status.Message
+		}
+
+		if progress != lastProgress {
+			fmt.Println(BrightBlack + progress + Reset)
+			lastProgress = progress
+		}
+
+		return false, nil
+	})
+	if errors.Is(err, wait.ErrTimeout) {
+		return fmt.Errorf("upgrade did not complete within %s, it continues in the background", cfg.Ceph.UpgradeWait)
+	}
+	if err != nil {
+		return fmt.Errorf("wait for upgrade: %w", err)
+	}
+
+	versions, err := sshClient.CephVersions()
+	if err != nil {
+		return fmt.Errorf("versions: %w", err)
+	}
+
+	for daemonType, counts := range versions {
+		for version := range counts {
+			if version != release {
+				return fmt.Errorf("upgrade stopped before all %s daemons were upgraded to %s", daemonType, release)
+			}
+		}
+	}
+
+	if err := updateRelease(release); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Upgraded to %s, run `labctl ceph install` to fetch the matching cephadm\n", release)
+
+	return nil
+}
+
+func upgradeStatusCommandFunc(cmd *cobra.Command, args []string) error {
+	sshClient, err := sshToRandomClusterNode()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	status, err := sshClient.CephUpgradeStatus()
+	if err != nil {
+		return fmt.Errorf("upgrade status: %w", err)
+	}
+
+	if !status.InProgress {
+		fmt.Println("No upgrade in progress 🙅‍♀️")
+		return nil
+	}
+
+	versions, err := sshClient.CephVersions()
+	if err != nil {
+		return fmt.Errorf("versions: %w", err)
+	}
+
+	// Target image is a tag, e.g. quay.io/ceph/ceph:v19.2.3, so the
+	// release can be recovered from it.
+	_, tag, _ := strings.Cut(status.TargetImage, ":")
+	release := strings.TrimPrefix(tag, "v")
+
+	state := "in progress"
+	if status.IsPaused {
+		state = "paused"
+	}
+
+	fmt.Printf("🚀 Upgrade to %s is %s\n", status.TargetImage, state)
+	fmt.Println(BrightBlack + " ↳ " + formatUpgradeProgress(versions, release) + Reset)
+	if status.Progress != "" {
+		fmt.Println(BrightBlack + " ↳ " + status.Progress + Reset)
+	}
+	if status.Message != "" {
+		fmt.Println(BrightBlack + " ↳ " + status.Message + Reset)
+	}
+
+	return nil
+}
+
+func upgradeControl(message string, fn func(*ssh.Client) error) error {
+	sshClient, err := sshToRandomClusterNode()
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	fmt.Println(message)
+
+	if err := fn(sshClient); err != nil {
+		return err
+	}
+
+	fmt.Println("✅ OK")
+
+	return nil
+}
+
+// updateRelease stores the release in the configuration file, so that
+// cephadm matching the cluster version is installed next time.
+func updateRelease(release string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	if cfg.Ceph.Release == release {
+		return nil
+	}
+
+	fmt.Printf("📝 Updating release from %s to %s\n", cfg.Ceph.Release, release)
+
+	if err := config.SetCephRelease("~/.labctl.hcl", release); err != nil {
+		return fmt.Errorf("update configuration: %w", err)
+	}
+
+	return nil
+}
+
+// formatUpgradeProgress returns a summary of how many daemons of each
+// type are running the release, e.g. "mgr 2/2, mon 1/3".
+func formatUpgradeProgress(versions ssh.CephVersions, release string) string {
+	daemonTypes := make([]string, 0, len(versions))
+	for daemonType := range versions {
+		daemonTypes = append(daemonTypes, daemonType)
+	}
+	slices.Sort(daemonTypes)
+
+	progress := make([]string, 0, len(daemonTypes))
+	for _, daemonType := range daemonTypes {
+		total := 0
+		for _, n := range versions[daemonType] {
+			total += n
+		}
+		progress = append(progress, fmt.Sprintf("%s %d/%d", daemonType, versions[daemonType][release], total))
+	}
+
+	return strings.Join(progress, ", ")
+}
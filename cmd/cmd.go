@@ -7,7 +7,11 @@ import (
 
 	"github.com/romantomjak/labctl/cmd/ceph"
 	"github.com/romantomjak/labctl/cmd/k8s"
+	"github.com/romantomjak/labctl/cmd/power"
 	"github.com/romantomjak/labctl/cmd/pve"
+	"github.com/romantomjak/labctl/cmd/ssh"
+	"github.com/romantomjak/labctl/cmd/wake"
+	labssh "github.com/romantomjak/labctl/ssh"
 )
 
 func Execute() {
@@ -18,9 +22,18 @@ func Execute() {
 
 	cmd.AddCommand(ceph.Command())
 	cmd.AddCommand(k8s.Command())
+	cmd.AddCommand(power.Command())
 	cmd.AddCommand(pve.Command())
+	cmd.AddCommand(ssh.Command())
+	cmd.AddCommand(wake.Command())
 
-	if err := cmd.Execute(); err != nil {
+	err := cmd.Execute()
+
+	// Connections shared between steps of a command are closed only once
+	// the command is done.
+	labssh.CloseAll()
+
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -2,18 +2,25 @@ package k8s
 
 import (
 	"bufio"
-	"crypto/sha512"
-	"errors"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"filippo.io/age"
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/cobra"
 
 	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/live"
 	"github.com/romantomjak/labctl/ssh"
+	"github.com/romantomjak/labctl/store"
+	"github.com/romantomjak/labctl/table"
 )
 
 var backupExample = strings.Trim(`
@@ -25,42 +32,112 @@ var backupExample = strings.Trim(`
 
   # Backup with desirable time format
   labctl k8s backup ~/Downloads/etcd-backup-$(date +%Y%m%d%H%M%S).db
+
+  # Take the snapshot from the etcd leader
+  labctl k8s backup --prefer leader /backup/etcd-snapshot.db
+
+  # Save timestamped backup with a manifest and prune old backups
+  labctl k8s backup --compress --dir /backup/etcd
+
+  # Stream backup to S3-compatible storage or an SFTP server
+  labctl k8s backup --dir s3://backups/etcd
+  labctl k8s backup --dir sftp://nas/backups/etcd
+
+  # List and verify backups in the directory
+  labctl k8s backup ls --dir /backup/etcd
+  labctl k8s backup verify --dir /backup/etcd
 `, "\n")
 
 var backup = &cobra.Command{
-	Use:          "backup [flags] <filename>",
+	Use:          "backup [flags] [<filename>]",
 	Short:        "Backup etcd cluster",
 	Example:      backupExample,
 	SilenceUsage: true,
-	Args:         cobra.ExactArgs(1),
+	Args:         cobra.MaximumNArgs(1),
 	RunE:         backupCommandFunc,
 }
 
+var backupList = &cobra.Command{
+	Use:          "ls",
+	Short:        "List backups in the backup directory",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         backupListCommandFunc,
+}
+
+var backupVerify = &cobra.Command{
+	Use:          "verify [flags] [<filename>...]",
+	Short:        "Verify backups in the backup directory against their manifests",
+	SilenceUsage: true,
+	RunE:         backupVerifyCommandFunc,
+}
+
 func backupCommandFunc(cmd *cobra.Command, args []string) error {
+	if flagPreferMember != "leader" && flagPreferMember != "follower" {
+		return fmt.Errorf(`--prefer must be "leader" or "follower", got %q`, flagPreferMember)
+	}
+
 	cfg, err := config.FromFile("~/.labctl.hcl")
 	if err != nil {
 		return fmt.Errorf("load configuration: %w", err)
 	}
+	etcd := *cfg.Kubernetes.Etcd
 
-	// Shell won't expand the path if argument is wrapped in quotes.
-	filename, err := expandTilde(args[0])
+	compression := ""
+	if flagCompressBackup {
+		compression = "zstd"
+	}
+
+	// Ask for the passphrase before anything is done on the cluster.
+	recipients, encryption, err := backupRecipients(cfg.Kubernetes.Backup)
 	if err != nil {
-		return err
+		return fmt.Errorf("backup encryption: %w", err)
 	}
 
-	// Check if we need to add zstd file extension.
-	if flagCompressBackup && !strings.HasSuffix(filename, ".zst") {
-		filename += ".zst"
+	// Without a filename, backup is saved to the backup directory.
+	var st store.Storage
+	var name string
+	created := time.Now()
+
+	switch {
+	case len(args) == 1 && flagBackupDir != "":
+		return fmt.Errorf("filename and --dir can't be used together")
+	case len(args) == 1:
+		// Shell won't expand the path if argument is wrapped in quotes.
+		filename, err := config.ExpandTilde(args[0])
+		if err != nil {
+			return err
+		}
+		st, name, err = store.Locate(filename, cfg)
+		if err != nil {
+			return err
+		}
+	default:
+		st, err = openBackupDir(cfg)
+		if err != nil {
+			return err
+		}
+		name = store.Name(cfg.Kubernetes.Name, created, compression, encryption)
 	}
+	defer st.Close()
 
-	// Check if the destination file already exists.
-	exists, err := fileExists(filename)
-	if err != nil {
-		return err
+	// Backups saved to the backup directory get a manifest, so that they
+	// can be listed, verified and pruned.
+	withManifest := len(args) == 0
+
+	// Check if we need to add zstd and age file extensions.
+	name = strings.TrimSuffix(name, store.EncryptedExt)
+	if flagCompressBackup && !strings.HasSuffix(name, ".zst") {
+		name += ".zst"
+	}
+	if encryption != "" {
+		name += store.EncryptedExt
 	}
+	location := store.Location(st, name)
 
-	if exists {
-		answer, err := prompt(fmt.Sprintf("❓ Overwrite %s? (y/n) [n] ", filename))
+	// Check if the destination file already exists.
+	if _, err := st.Size(name); err == nil {
+		answer, err := prompt(fmt.Sprintf("❓ Overwrite %s? (y/n) [n] ", location))
 		if err != nil {
 			return err
 		}
@@ -74,32 +151,93 @@ func backupCommandFunc(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	fmt.Println("🔒 Connecting to k8s")
+	fmt.Println("🩺 Choosing etcd member")
 
-	sshClient, err := ssh.New(cfg.Kubernetes.Node)
+	member, err := chooseMember(cfg.Kubernetes.Nodes, etcd, flagPreferMember)
 	if err != nil {
-		return fmt.Errorf("ssh: %w", err)
+		return err
+	}
+	sshClient := member.client
+
+	members, err := sshClient.EtcdMembers(etcd)
+	if err != nil {
+		return fmt.Errorf("etcd members: %w", err)
 	}
-	defer sshClient.Close()
 
 	fmt.Println("⚡️ Snapshotting etcd database")
-	snapshot := fmt.Sprintf("/tmp/etcd-backup-%d.db", time.Now().UnixMilli())
-	if err := sshClient.SnapshotETCD(snapshot); err != nil {
+
+	// Snapshot contains all secrets of the cluster, so it is kept where
+	// other users can't read it, and removed however the backup ends.
+	tmpDir, err := sshClient.MakeTempDir()
+	if err != nil {
+		return err
+	}
+	defer sshClient.RemoveTempDir(tmpDir)
+
+	snapshot := tmpDir + "/etcd-backup.db"
+
+	line := live.NewLine(os.Stdout)
+	err = sshClient.SnapshotETCD(etcd, snapshot, func(_ ssh.Stream, l string) {
+		line.Update(etcdctlStatus(l))
+	})
+	if err != nil {
 		return fmt.Errorf("snapshot etcd: %w", err)
 	}
 
+	size, err := sshClient.FileSize(snapshot)
+	if err != nil {
+		return fmt.Errorf("snapshot size: %w", err)
+	}
+	line.Update("Snapshot size is " + humanize.IBytes(uint64(size)))
+
+	snapshotStatus, err := sshClient.EtcdSnapshotStatus(etcd, snapshot)
+	if err != nil {
+		return fmt.Errorf("snapshot status: %w", err)
+	}
+
 	if flagCompressBackup {
 		fmt.Println("📦 Compressing snapshot with zstd")
-		if err := sshClient.Compress(snapshot); err != nil {
+
+		line := live.NewLine(os.Stdout)
+		err := sshClient.Compress(snapshot, func(_ ssh.Stream, l string) {
+			line.Update(strings.TrimSpace(l))
+		})
+		if err != nil {
 			return fmt.Errorf("compress: %w", err)
 		}
 
 		// From here, snapshot filename should include the zstd file extension.
 		snapshot += ".zst"
+
+		compressed, err := sshClient.FileSize(snapshot)
+		if err != nil {
+			return fmt.Errorf("snapshot size: %w", err)
+		}
+		line.Update(fmt.Sprintf("%s → %s (%.1f%% of original size)", humanize.IBytes(uint64(size)), humanize.IBytes(uint64(compressed)), ratio(compressed, size)))
 	}
 
 	fmt.Println("⌛️ Downloading snapshot")
-	if err := sshClient.Copy(snapshot, filename); err != nil {
+
+	// Snapshot is new every time, so there is nothing to resume.
+	opts := ssh.TransferOptions{}
+	if encryption != "" {
+		opts.WrapDst = func(w io.Writer) (io.WriteCloser, error) {
+			return age.Encrypt(w, recipients...)
+		}
+	}
+
+	line = live.NewLine(os.Stdout)
+	opts.Progress = func(p ssh.Progress) { line.Update(formatProgress(p)) }
+
+	// Snapshot is streamed from the control plane node to storage, without
+	// going through local disk.
+	var download *ssh.TransferResult
+	storedSHA512, err := store.Write(st, name, func(w io.Writer) error {
+		var err error
+		download, err = sshClient.DownloadTo(snapshot, w, opts)
+		return err
+	})
+	if err != nil {
 		return fmt.Errorf("download snapshot: %w", err)
 	}
 
@@ -109,75 +247,360 @@ func backupCommandFunc(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("remote sha512sum: %w", err)
 	}
 
-	localSHA512, err := sha512sum(filename)
-	if err != nil {
-		return fmt.Errorf("local sha512sum: %w", err)
+	if download.SHA512 != remoteSHA512 {
+		return fmt.Errorf("sha512 hashes are not matching")
 	}
 
-	if localSHA512 != remoteSHA512 {
-		return fmt.Errorf("sha512 hashes are not matching")
+	// Read the backup back, to make sure storage has what was sent.
+	if err := store.Check(st, name, storedSHA512); err != nil {
+		return err
 	}
 
 	// Cleanup remote
-	if err := sshClient.Delete(snapshot); err != nil {
+	if err := sshClient.RemoveTempDir(tmpDir); err != nil {
 		return fmt.Errorf("delete remote copy: %w", err)
 	}
 
-	fmt.Printf("✅ Snapshot saved at %s\n", filename)
+	if withManifest {
+		manifest := &store.Manifest{
+			Filename:    name,
+			Cluster:     cfg.Kubernetes.Name,
+			Created:     created,
+			Member:      member.node.Name,
+			Revision:    snapshotStatus.Revision,
+			SHA512:      download.SHA512,
+			Size:        download.Size,
+			Compression: compression,
+			Encryption:  encryption,
+		}
+		if err := store.WriteManifest(st, manifest); err != nil {
+			return fmt.Errorf("write manifest: %w", err)
+		}
+	}
+
+	fmt.Printf("✅ Snapshot saved at %s\n", location)
+
+	status := member.status.Status
+	fmt.Println(BrightBlack + fmt.Sprintf(" ↳ revision %d, database size %s", snapshotStatus.Revision, humanize.IBytes(uint64(status.DBSize))) + Reset)
+	switch encryption {
+	case store.EncryptionAge:
+		fmt.Println(BrightBlack + fmt.Sprintf(" ↳ encrypted to %d recipients", len(recipients)) + Reset)
+	case store.EncryptionPassphrase:
+		fmt.Println(BrightBlack + " ↳ encrypted with passphrase" + Reset)
+	}
+	for _, m := range members {
+		var notes []string
+		if m.ID == status.Leader {
+			notes = append(notes, "leader")
+		}
+		if m.IsLearner {
+			notes = append(notes, "learner")
+		}
+		if m.ID == status.Header.MemberID {
+			notes = append(notes, "backed up")
+		}
+
+		s := " ↳ member " + m.Name
+		if len(notes) > 0 {
+			s += " (" + strings.Join(notes, ", ") + ")"
+		}
+		fmt.Println(BrightBlack + s + Reset)
+	}
+
+	if withManifest {
+		if err := pruneBackups(st, cfg.Kubernetes.Name, cfg.Kubernetes.Backup); err != nil {
+			return fmt.Errorf("prune backups: %w", err)
+		}
+	}
 
 	return nil
 }
 
-func expandTilde(filename string) (string, error) {
-	if !strings.HasPrefix(filename, "~") {
-		return filename, nil
+func backupListCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
 	}
 
-	home, err := os.UserHomeDir()
+	st, err := openBackupDir(cfg)
 	if err != nil {
-		return "", fmt.Errorf("get home directory: %w", err)
+		return err
 	}
+	defer st.Close()
 
-	return strings.Replace(filename, "~", home, 1), nil
-}
-
-func prompt(prompt string) (string, error) {
-	fmt.Fprint(os.Stdout, prompt)
+	manifests, err := store.List(st)
+	if err != nil {
+		return fmt.Errorf("list backups: %w", err)
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
+	if len(manifests) == 0 {
+		fmt.Println("No backups found in " + st.String())
+		return nil
+	}
 
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("read input: %w", err)
+	t := table.New("NAME", "CREATED", "CLUSTER", "MEMBER", "REVISION", "SIZE", "COMPRESSION", "ENCRYPTION")
+	for _, m := range manifests {
+		compression := m.Compression
+		if compression == "" {
+			compression = "none"
+		}
+		encryption := m.Encryption
+		if encryption == "" {
+			encryption = "none"
+		}
+		t.AddRow(
+			m.Filename,
+			m.Created.Local().Format(time.DateTime),
+			m.Cluster,
+			m.Member,
+			strconv.FormatInt(m.Revision, 10),
+			humanize.IBytes(uint64(m.Size)),
+			compression,
+			encryption,
+		)
 	}
 
-	return scanner.Text(), nil
+	return t.Print(os.Stdout)
 }
 
-func sha512sum(filename string) (string, error) {
-	hash := sha512.New()
+func backupVerifyCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
 
-	f, err := os.Open(filename)
+	st, err := openBackupDir(cfg)
 	if err != nil {
-		return "", fmt.Errorf("open file: %w", err)
+		return err
 	}
-	defer f.Close()
+	defer st.Close()
 
-	_, err = io.Copy(hash, f)
+	manifests, err := store.List(st)
 	if err != nil {
-		return "", fmt.Errorf("read file: %w", err)
+		return fmt.Errorf("list backups: %w", err)
+	}
+
+	// Verify only the given backups, if any.
+	if len(args) > 0 {
+		var selected []store.Manifest
+		for _, name := range args {
+			i := slices.IndexFunc(manifests, func(m store.Manifest) bool {
+				return m.Filename == filepath.Base(name)
+			})
+			if i < 0 {
+				return fmt.Errorf("%s has no manifest in %s", name, st)
+			}
+			selected = append(selected, manifests[i])
+		}
+		manifests = selected
+	}
+
+	// Encrypted backups are decrypted while they are verified. Passphrase
+	// is only asked for if there are backups encrypted with it.
+	var identities []age.Identity
+	for _, encryption := range []string{store.EncryptionAge, store.EncryptionPassphrase} {
+		if !slices.ContainsFunc(manifests, func(m store.Manifest) bool { return m.Encryption == encryption }) {
+			continue
+		}
+		ids, err := backupIdentities(cfg.Kubernetes.Backup, encryption == store.EncryptionPassphrase)
+		if err != nil {
+			return fmt.Errorf("backup encryption: %w", err)
+		}
+		identities = append(identities, ids...)
+	}
+
+	failed := 0
+	for _, m := range manifests {
+		if err := store.Verify(st, m, identities...); err != nil {
+			fmt.Printf("❌ %s: %s\n", m.Filename, err)
+			failed++
+			continue
+		}
+		fmt.Printf("✅ %s\n", m.Filename)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d backups failed verification", failed, len(manifests))
+	}
+
+	return nil
+}
+
+// openBackupDir returns storage for the backup directory given on the
+// command line, or the one from the configuration file.
+func openBackupDir(cfg *config.Config) (store.Storage, error) {
+	dir := cfg.Kubernetes.Backup.Dir
+	if flagBackupDir != "" {
+		// Shell won't expand the path if argument is wrapped in quotes.
+		var err error
+		dir, err = config.ExpandTilde(flagBackupDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("backup directory is not set, use --dir or set dir in the kubernetes backup block")
 	}
 
-	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+	return store.New(dir, cfg)
 }
 
-func fileExists(name string) (bool, error) {
-	_, err := os.Stat(name)
+// pruneBackups removes backups of the cluster that are not kept by the
+// retention rules. Backups of other clusters sharing the storage are left
+// alone, they have retention rules of their own.
+func pruneBackups(st store.Storage, cluster string, cfg *config.Backup) error {
+	retention := store.Retention{
+		Hourly: cfg.KeepHourly,
+		Daily:  cfg.KeepDaily,
+		Weekly: cfg.KeepWeekly,
+	}
+	if !retention.Enabled() {
+		return nil
+	}
+
+	all, err := store.List(st)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return false, nil
+		return err
+	}
+
+	var manifests []store.Manifest
+	for _, m := range all {
+		if m.Cluster == cluster {
+			manifests = append(manifests, m)
+		}
+	}
+
+	_, remove := retention.Apply(manifests)
+	if len(remove) == 0 {
+		return nil
+	}
+
+	fmt.Printf("🧹 Removing %d old backups\n", len(remove))
+
+	for _, m := range remove {
+		fmt.Println(BrightBlack + " ↳ " + m.Filename + Reset)
+		if err := store.Remove(st, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// etcdMember is a healthy etcd member running on a control plane node.
+type etcdMember struct {
+	node   config.Node
+	client *ssh.Client
+	status *ssh.EtcdEndpointStatus
+}
+
+// chooseMember returns a healthy etcd member, preferring the leader or a
+// follower. When there is no healthy member in the preferred role, any
+// healthy member is returned.
+func chooseMember(nodes []config.Node, etcd config.Etcd, prefer string) (*etcdMember, error) {
+	var healthy []*etcdMember
+	for _, node := range nodes {
+		member, err := checkMember(node, etcd)
+		if err != nil {
+			fmt.Println(BrightBlack + " ↳ " + node.Name + ": " + err.Error() + Reset)
+			continue
 		}
-		return false, err
+
+		role := "follower"
+		if member.status.IsLeader() {
+			role = "leader"
+		}
+		fmt.Println(BrightBlack + " ↳ " + node.Name + ": healthy " + role + Reset)
+
+		healthy = append(healthy, member)
+	}
+
+	if len(healthy) == 0 {
+		return nil, fmt.Errorf("no healthy etcd member found")
+	}
+
+	chosen := healthy[0]
+	for _, member := range healthy {
+		if member.status.IsLeader() == (prefer == "leader") {
+			chosen = member
+			break
+		}
+	}
+
+	fmt.Println(BrightBlack + " ↳ using " + chosen.node.Name + Reset)
+
+	return chosen, nil
+}
+
+func checkMember(node config.Node, etcd config.Etcd) (*etcdMember, error) {
+	sshClient, err := ssh.Get(node)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: %w", err)
+	}
+
+	healthy, err := sshClient.EtcdEndpointHealth(etcd)
+	if err != nil {
+		return nil, err
+	}
+	if !healthy {
+		return nil, fmt.Errorf("unhealthy")
+	}
+
+	status, err := sshClient.EtcdEndpointStatus(etcd)
+	if err != nil {
+		return nil, err
+	}
+
+	return &etcdMember{node: node, client: sshClient, status: status}, nil
+}
+
+// etcdctlStatus turns etcdctl output into a short status line. etcdctl
+// logs JSON to stderr, e.g. {"level":"info","msg":"fetched snapshot",
+// "size":"3.2 MB"}, other output is returned as is.
+func etcdctlStatus(line string) string {
+	var entry struct {
+		Msg  string `json:"msg"`
+		Size string `json:"size"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil || entry.Msg == "" {
+		return strings.TrimSpace(line)
+	}
+
+	status := entry.Msg
+	if entry.Size != "" {
+		status += " (" + entry.Size + ")"
+	}
+
+	return status
+}
+
+// ratio returns compressed size as a percentage of the original size.
+func ratio(compressed, original int64) float64 {
+	if original == 0 {
+		return 0
+	}
+	return float64(compressed) / float64(original) * 100
+}
+
+func prompt(prompt string) (string, error) {
+	fmt.Fprint(os.Stdout, prompt)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read input: %w", err)
+	}
+
+	return scanner.Text(), nil
+}
+
+// formatProgress returns transfer progress, e.g.
+// "12 MiB / 40 MiB, 5.2 MiB/s, 6s left".
+func formatProgress(p ssh.Progress) string {
+	s := fmt.Sprintf("%s / %s, %s/s", humanize.IBytes(uint64(p.Transferred)), humanize.IBytes(uint64(p.Total)), humanize.IBytes(uint64(p.Rate)))
+	if p.ETA > 0 {
+		s += fmt.Sprintf(", %s left", p.ETA.Round(time.Second))
 	}
-	return true, nil
+	return s
 }
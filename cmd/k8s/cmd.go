@@ -1,11 +1,29 @@
 package k8s
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
+const (
+	Reset       = "\033[0m"
+	BrightBlack = "\033[90m"
+)
+
 var (
 	flagCompressBackup bool
+	flagPreferMember   string
+	flagBackupDir      string
+	flagAssumeYes      bool
+	flagDryRun         bool
+	flagRestoreWait    time.Duration
+
+	flagPrintToken      bool
+	flagTokenAudiences  []string
+	flagTokenExpiration time.Duration
+
+	flagStatusJSON bool
 )
 
 func Command() *cobra.Command {
@@ -14,10 +32,25 @@ func Command() *cobra.Command {
 		Short: "Interact with kubernetes cluster",
 	}
 
+	dashboard.Flags().BoolVar(&flagPrintToken, "print", false, "print token instead of copying it to clipboard and opening dashboard")
+	dashboard.Flags().StringSliceVar(&flagTokenAudiences, "audience", nil, "intended audience of the token, can be repeated (overrides audiences)")
+	dashboard.Flags().DurationVar(&flagTokenExpiration, "expiration", 0, "how long the token is valid for (overrides expiration)")
 	cmd.AddCommand(dashboard)
 
 	backup.Flags().BoolVar(&flagCompressBackup, "compress", false, "compress backup with zstd")
+	backup.Flags().StringVar(&flagPreferMember, "prefer", "follower", `etcd member to take the snapshot from, "leader" or "follower"`)
+	backup.PersistentFlags().StringVar(&flagBackupDir, "dir", "", "backup directory or URL, e.g. s3://bucket/prefix, for timestamped backups (overrides dir in backup block)")
+	backup.AddCommand(backupList)
+	backup.AddCommand(backupVerify)
 	cmd.AddCommand(backup)
 
+	restore.Flags().BoolVarP(&flagAssumeYes, "assume-yes", "y", false, `assume "yes" as answer to all prompts`)
+	restore.Flags().BoolVar(&flagDryRun, "dry-run", false, "verify snapshot and show what would be done without changing anything")
+	restore.Flags().DurationVar(&flagRestoreWait, "wait", 5*time.Minute, "how long to wait for pods to stop and for API server to become ready")
+	cmd.AddCommand(restore)
+
+	status.Flags().BoolVar(&flagStatusJSON, "json", false, "output status as JSON")
+	cmd.AddCommand(status)
+
 	return cmd
 }
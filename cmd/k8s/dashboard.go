@@ -1,93 +1,109 @@
 package k8s
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/romantomjak/labctl/browser"
+	"github.com/romantomjak/labctl/clipboard"
 	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/kube"
 )
 
+var dashboardExample = strings.Trim(`
+  # Copy token to clipboard and open dashboard
+  labctl k8s dashboard
+
+  # Print token instead, e.g. to use it elsewhere
+  labctl k8s dashboard --print
+
+  # Request a token that is valid for a working day
+  labctl k8s dashboard --expiration 8h
+`, "\n")
+
 var dashboard = &cobra.Command{
 	Use:          "dashboard",
 	Short:        "Generate token and open dashboard",
+	Example:      dashboardExample,
+	Args:         cobra.NoArgs,
 	SilenceUsage: true,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := config.FromFile("~/.labctl.hcl")
-		if err != nil {
-			return fmt.Errorf("load configuration: %w", err)
-		}
-
-		token, err := kubectlCreateToken(cfg)
-		if err != nil {
-			return fmt.Errorf("kubectl: %w", err)
-		}
-
-		if err := pbcopy(token); err != nil {
-			return fmt.Errorf("pbcopy: %w", err)
-		}
-
-		if err := exec.Command("open", cfg.Kubernetes.Dashboard.URL).Start(); err != nil {
-			return fmt.Errorf("open: %w", err)
-		}
-
-		return nil
-	},
+	RunE:         dashboardCommandFunc,
 }
 
-func kubectlCreateToken(cfg *config.Config) ([]byte, error) {
-	cmd := exec.Command("kubectl", "-n", cfg.Kubernetes.Dashboard.Namespace, "create", "token", cfg.Kubernetes.Dashboard.User)
+// minTokenExpiration is the shortest expiration the TokenRequest API
+// accepts.
+const minTokenExpiration = 10 * time.Minute
 
-	out, err := cmd.StdoutPipe()
+func dashboardCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
 	if err != nil {
-		return nil, fmt.Errorf("get stdout pipe: %w", err)
+		return fmt.Errorf("load configuration: %w", err)
 	}
 
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("start command: %w", err)
+	dash := cfg.Kubernetes.Dashboard
+	if len(flagTokenAudiences) > 0 {
+		dash.Audiences = flagTokenAudiences
+	}
+	if flagTokenExpiration > 0 {
+		dash.Expiration = flagTokenExpiration
+	}
+	if dash.Expiration < minTokenExpiration {
+		return fmt.Errorf("token expiration must be at least %s, got %s", minTokenExpiration, dash.Expiration)
 	}
 
-	buf := new(bytes.Buffer)
-	if _, err := buf.ReadFrom(out); err != nil {
-		return nil, fmt.Errorf("read stdout: %w", err)
+	token, expires, err := createToken(cfg.Kubernetes, dash)
+	if err != nil {
+		return err
 	}
 
-	if err := out.Close(); err != nil {
-		return nil, fmt.Errorf("close stdout: %w", err)
+	// Only the token is printed, so that it can be piped elsewhere.
+	if flagPrintToken {
+		fmt.Println(token)
+		return nil
 	}
 
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("wait for command to exit: %w", err)
+	if err := clipboard.Write(token); err != nil {
+		return fmt.Errorf("copy token to clipboard, use --print instead: %w", err)
 	}
 
-	return buf.Bytes(), nil
-}
+	fmt.Printf("🔑 Token for %s copied to clipboard\n", dash.User)
+	fmt.Println(BrightBlack + " ↳ expires at " + expires.Local().Format(time.DateTime) + Reset)
 
-func pbcopy(token []byte) error {
-	cmd := exec.Command("pbcopy")
+	fmt.Println("🌐 Opening " + dash.URL)
 
-	in, err := cmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("get stdin pipe: %w", err)
+	if err := browser.Open(dash.URL); err != nil {
+		return fmt.Errorf("open browser: %w", err)
 	}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("start command: %w", err)
-	}
+	return nil
+}
 
-	if _, err := in.Write(token); err != nil {
-		return err
+// createToken requests a service account token with the TokenRequest API,
+// same as `kubectl create token` does.
+func createToken(cfg config.Kubernetes, dash config.KubernetesDashboard) (string, time.Time, error) {
+	client, err := kube.NewClient(cfg)
+	if err != nil {
+		return "", time.Time{}, err
 	}
 
-	if err := in.Close(); err != nil {
-		return fmt.Errorf("close stdin: %w", err)
+	expiration := int64(dash.Expiration.Seconds())
+	req := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			Audiences:         dash.Audiences,
+			ExpirationSeconds: &expiration,
+		},
 	}
 
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("wait for command to exit: %w", err)
+	resp, err := client.CoreV1().ServiceAccounts(dash.Namespace).CreateToken(context.Background(), dash.User, req, metav1.CreateOptions{})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("create token for %s/%s: %w", dash.Namespace, dash.User, err)
 	}
 
-	return nil
+	return resp.Status.Token, resp.Status.ExpirationTimestamp.Time, nil
 }
@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+
+	"filippo.io/age"
+	"golang.org/x/term"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/store"
+)
+
+// passphraseEnv is read instead of prompting for the backup passphrase,
+// e.g. when backups are taken from cron.
+const passphraseEnv = "LABCTL_BACKUP_PASSPHRASE"
+
+// backupRecipients returns recipients to encrypt backups to, and the kind
+// of encryption that is recorded in the manifest. Both are empty if
+// encryption is not configured.
+func backupRecipients(cfg *config.Backup) ([]age.Recipient, string, error) {
+	switch {
+	case len(cfg.Recipients) > 0:
+		recipients, err := store.ParseRecipients(cfg.Recipients)
+		if err != nil {
+			return nil, "", err
+		}
+		return recipients, store.EncryptionAge, nil
+	case cfg.Passphrase:
+		passphrase, err := readPassphrase(true)
+		if err != nil {
+			return nil, "", err
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, "", err
+		}
+		return []age.Recipient{r}, store.EncryptionPassphrase, nil
+	}
+	return nil, "", nil
+}
+
+// backupIdentities returns identities to decrypt backups with. Identity
+// file is used for backups encrypted to recipients, passphrase is only
+// asked for when passphrase is true.
+func backupIdentities(cfg *config.Backup, passphrase bool) ([]age.Identity, error) {
+	if passphrase {
+		p, err := readPassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		identity, err := age.NewScryptIdentity(p)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	if cfg.IdentityFile == "" {
+		return nil, fmt.Errorf("backup is encrypted, but identity_file is not set in the kubernetes backup block")
+	}
+
+	return store.ParseIdentityFile(cfg.IdentityFile)
+}
+
+func readPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("can't prompt for passphrase: stdin is not a terminal, set %s instead", passphraseEnv)
+	}
+
+	p, err := readSecret(fd, "🔑 Backup passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if p == "" {
+		return "", fmt.Errorf("passphrase can't be empty")
+	}
+
+	if confirm {
+		again, err := readSecret(fd, "🔑 Confirm backup passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if p != again {
+			return "", fmt.Errorf("passphrases don't match")
+		}
+	}
+
+	return p, nil
+}
+
+func readSecret(fd int, prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read input: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,323 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/live"
+	"github.com/romantomjak/labctl/ssh"
+	"github.com/romantomjak/labctl/store"
+	"github.com/romantomjak/labctl/wait"
+)
+
+// staticPods are stopped while etcd data is replaced. API server is
+// stopped as well, so that nothing writes to etcd during the restore.
+var staticPods = []string{"etcd", "kube-apiserver"}
+
+var restoreExample = strings.Trim(`
+  # Restore etcd from a backup
+  labctl k8s restore /backup/etcd-snapshot.db.zst
+
+  # Show what would be done without changing anything
+  labctl k8s restore --dry-run /backup/etcd-snapshot.db
+
+  # Restore encrypted backup, it is decrypted while uploading
+  labctl k8s restore /backup/etcd-lab-20260102T150405Z.db.zst.age
+
+  # Restore backup from S3-compatible storage
+  labctl k8s restore s3://backups/etcd/etcd-lab-20260102T150405Z.db.zst
+`, "\n")
+
+var restore = &cobra.Command{
+	Use:          "restore [flags] <filename>",
+	Short:        "Restore etcd cluster from backup",
+	Example:      restoreExample,
+	SilenceUsage: true,
+	Args:         cobra.ExactArgs(1),
+	RunE:         restoreCommandFunc,
+}
+
+func restoreCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+	etcd := *cfg.Kubernetes.Etcd
+
+	// Restoring a multi-member cluster requires restoring every member
+	// from the same snapshot with matching cluster configuration.
+	if len(cfg.Kubernetes.Nodes) > 1 {
+		return fmt.Errorf("restoring clusters with multiple control plane nodes is not supported")
+	}
+	node := cfg.Kubernetes.Nodes[0]
+
+	// Shell won't expand the path if argument is wrapped in quotes.
+	filename, err := config.ExpandTilde(args[0])
+	if err != nil {
+		return err
+	}
+
+	st, name, err := store.Locate(filename, cfg)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	size, err := st.Size(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", store.Location(st, name), err)
+	}
+
+	// Encrypted backups are decrypted while they are uploaded, so the
+	// snapshot is never written to disk in plaintext.
+	var identities []age.Identity
+	if strings.HasSuffix(name, store.EncryptedExt) {
+		passphrase, err := passphraseEncrypted(st, name)
+		if err != nil {
+			return err
+		}
+		identities, err = backupIdentities(cfg.Kubernetes.Backup, passphrase)
+		if err != nil {
+			return fmt.Errorf("backup encryption: %w", err)
+		}
+	}
+
+	fmt.Println("🔒 Connecting to k8s")
+
+	sshClient, err := ssh.New(node)
+	if err != nil {
+		return fmt.Errorf("ssh: %w", err)
+	}
+	defer sshClient.Close()
+
+	// Snapshot contains all secrets of the cluster, so it is kept where
+	// other users can't read it, and removed however the restore ends.
+	tmpDir, err := sshClient.MakeTempDir()
+	if err != nil {
+		return err
+	}
+	defer sshClient.RemoveTempDir(tmpDir)
+
+	ts := time.Now().UnixMilli()
+	snapshot := tmpDir + "/etcd-restore.db"
+	remote := snapshot
+	if strings.HasSuffix(strings.TrimSuffix(name, store.EncryptedExt), ".zst") {
+		remote += ".zst"
+	}
+
+	fmt.Println("⌛️ Uploading snapshot")
+
+	opts := ssh.TransferOptions{}
+	if identities != nil {
+		opts.WrapSrc = func(r io.Reader) (io.Reader, error) {
+			return age.Decrypt(r, identities...)
+		}
+	}
+
+	r, err := st.Get(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	line := live.NewLine(os.Stdout)
+	opts.Progress = func(p ssh.Progress) { line.Update(formatProgress(p)) }
+	upload, err := sshClient.UploadFrom(r, size, remote, opts)
+	if err != nil {
+		return fmt.Errorf("upload snapshot: %w", err)
+	}
+
+	remoteSHA512, err := sshClient.SHA512Sum(remote)
+	if err != nil {
+		return fmt.Errorf("remote sha512sum: %w", err)
+	}
+	if upload.SHA512 != remoteSHA512 {
+		return fmt.Errorf("sha512 hashes are not matching")
+	}
+
+	if remote != snapshot {
+		fmt.Println("📦 Decompressing snapshot")
+
+		line := live.NewLine(os.Stdout)
+		err := sshClient.Decompress(remote, func(_ ssh.Stream, l string) {
+			line.Update(strings.TrimSpace(l))
+		})
+		if err != nil {
+			return fmt.Errorf("decompress: %w", err)
+		}
+	}
+
+	fmt.Println("🔍 Verifying snapshot")
+
+	status, err := sshClient.EtcdSnapshotStatus(etcd, snapshot)
+	if err != nil {
+		return fmt.Errorf("snapshot status: %w", err)
+	}
+
+	fmt.Println(BrightBlack + fmt.Sprintf(" ↳ revision %d, %d keys, %s", status.Revision, status.TotalKey, humanize.IBytes(uint64(status.TotalSize))) + Reset)
+
+	member, err := sshClient.EtcdMember()
+	if err != nil {
+		return fmt.Errorf("etcd member: %w", err)
+	}
+
+	dataDir := path.Clean(member.DataDir)
+	restoreDir := fmt.Sprintf("%s.restore-%d", dataDir, ts)
+	oldDataDir := fmt.Sprintf("%s.old-%d", dataDir, ts)
+	stoppedDir := fmt.Sprintf("%s.stopped-%d", ssh.ManifestsDir, ts)
+
+	if flagDryRun {
+		fmt.Println("📝 Dry run, would have:")
+		for _, step := range []string{
+			"moved " + strings.Join(staticPods, " and ") + " manifests to " + stoppedDir,
+			"restored snapshot into " + restoreDir,
+			"moved " + dataDir + " to " + oldDataDir,
+			"moved " + restoreDir + " to " + dataDir,
+			"moved manifests back to " + ssh.ManifestsDir,
+			"waited for API server to become ready",
+		} {
+			fmt.Println(BrightBlack + " ↳ " + step + Reset)
+		}
+		return nil
+	}
+
+	if !flagAssumeYes {
+		answer, err := prompt(fmt.Sprintf("❓ Replace all cluster state on %s with the snapshot? (y/n) [n] ", node.Name))
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			break // continue
+		default:
+			fmt.Println("🙅‍♀️ Not restoring the snapshot")
+			return nil
+		}
+	}
+
+	fmt.Println("🛑 Stopping static pods")
+
+	if err := sshClient.MakeDir(stoppedDir); err != nil {
+		return err
+	}
+
+	var stopped []string
+	for _, pod := range staticPods {
+		fmt.Println(BrightBlack + " ↳ " + pod + Reset)
+		if err := sshClient.Move(ssh.ManifestsDir+"/"+pod+".yaml", stoppedDir+"/"+pod+".yaml"); err != nil {
+			return restoreFailed(sshClient, stoppedDir, stopped, fmt.Errorf("stop %s: %w", pod, err))
+		}
+		stopped = append(stopped, pod)
+	}
+
+	err = wait.PollWithTimeout(flagRestoreWait, wait.DefaultBackoff, func(ctx context.Context) (bool, error) {
+		for _, pod := range staticPods {
+			running, err := sshClient.ContainersRunning(pod)
+			if err != nil || running {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return restoreFailed(sshClient, stoppedDir, stopped, fmt.Errorf("wait for pods to stop: %w", err))
+	}
+
+	fmt.Println("♻️  Restoring snapshot")
+
+	line = live.NewLine(os.Stdout)
+	err = sshClient.EtcdSnapshotRestore(etcd, snapshot, restoreDir, *member, func(_ ssh.Stream, l string) {
+		line.Update(etcdctlStatus(l))
+	})
+	if err != nil {
+		return restoreFailed(sshClient, stoppedDir, stopped, err)
+	}
+
+	fmt.Println("🔀 Swapping data directory")
+	fmt.Println(BrightBlack + " ↳ previous data is kept at " + oldDataDir + Reset)
+
+	if err := sshClient.Move(dataDir, oldDataDir); err != nil {
+		return restoreFailed(sshClient, stoppedDir, stopped, err)
+	}
+	if err := sshClient.Move(restoreDir, dataDir); err != nil {
+		// Put the previous data back, so that etcd starts as it was.
+		if rerr := sshClient.Move(oldDataDir, dataDir); rerr != nil {
+			return fmt.Errorf("%w, and failed to move %s back: %v", err, oldDataDir, rerr)
+		}
+		return restoreFailed(sshClient, stoppedDir, stopped, err)
+	}
+
+	fmt.Println("▶️  Starting static pods")
+
+	if err := startStaticPods(sshClient, stoppedDir, stopped); err != nil {
+		return err
+	}
+
+	fmt.Println("⏳ Waiting for API server")
+
+	err = wait.PollWithTimeout(flagRestoreWait, wait.DefaultBackoff, func(ctx context.Context) (bool, error) {
+		return sshClient.APIServerReady()
+	})
+	if err != nil {
+		return fmt.Errorf("wait for api server: %w", err)
+	}
+
+	fmt.Printf("✅ Restored etcd to revision %d\n", status.Revision)
+
+	return nil
+}
+
+// passphraseEncrypted reports whether the backup was encrypted with a
+// passphrase, rather than to recipients.
+func passphraseEncrypted(st store.Storage, name string) (bool, error) {
+	r, err := st.Get(name)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	passphrase, err := store.PassphraseEncrypted(r)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return passphrase, nil
+}
+
+// restoreFailed starts static pods that were stopped, so that a failed
+// restore doesn't leave the cluster down.
+func restoreFailed(sshClient *ssh.Client, stoppedDir string, stopped []string, err error) error {
+	fmt.Println("⚠️  Restore failed, starting static pods")
+
+	if serr := startStaticPods(sshClient, stoppedDir, stopped); serr != nil {
+		return fmt.Errorf("%w, and failed to start static pods: %v", err, serr)
+	}
+
+	return err
+}
+
+func startStaticPods(sshClient *ssh.Client, stoppedDir string, pods []string) error {
+	for _, pod := range pods {
+		src := stoppedDir + "/" + pod + ".yaml"
+		if err := sshClient.Move(src, ssh.ManifestsDir+"/"+pod+".yaml"); err != nil {
+			return fmt.Errorf("start %s, manifest is at %s: %w", pod, src, err)
+		}
+	}
+
+	if err := sshClient.RemoveDir(stoppedDir); err != nil {
+		return err
+	}
+
+	return nil
+}
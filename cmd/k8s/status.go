@@ -0,0 +1,258 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/kube"
+	"github.com/romantomjak/labctl/ssh"
+	"github.com/romantomjak/labctl/table"
+)
+
+// statusTimeout limits how long Kubernetes API requests may take.
+const statusTimeout = 30 * time.Second
+
+// certWarning is how long before expiry certificates are flagged.
+const certWarning = 30 * 24 * time.Hour
+
+var statusExample = strings.Trim(`
+  # Show cluster overview
+  labctl k8s status
+
+  # Show cluster overview as JSON, e.g. for monitoring
+  labctl k8s status --json
+`, "\n")
+
+var status = &cobra.Command{
+	Use:          "status",
+	Short:        "Show cluster overview",
+	Example:      statusExample,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE:         statusCommandFunc,
+}
+
+type clusterStatus struct {
+	Nodes        []kube.Node      `json:"nodes"`
+	ControlPlane []kube.Component `json:"control_plane"`
+
+	// UnhealthyPods are grouped by namespace.
+	UnhealthyPods map[string][]kube.Pod `json:"unhealthy_pods"`
+	PendingPVCs   []kube.PVC            `json:"pending_pvcs"`
+
+	Certificates []nodeCerts `json:"certificates"`
+}
+
+// nodeCerts are kubeadm certificates of a control plane node. Error is
+// set if they couldn't be read.
+type nodeCerts struct {
+	Node         string       `json:"node"`
+	Certificates []certStatus `json:"certificates,omitempty"`
+	Error        string       `json:"error,omitempty"`
+}
+
+type certStatus struct {
+	Name              string    `json:"name"`
+	CA                bool      `json:"ca"`
+	Expires           time.Time `json:"expires"`
+	ExternallyManaged bool      `json:"externally_managed"`
+}
+
+func statusCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	st, err := clusterOverview(cfg)
+	if err != nil {
+		return err
+	}
+
+	if flagStatusJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(st)
+	}
+
+	printStatus(st)
+
+	return nil
+}
+
+func clusterOverview(cfg *config.Config) (*clusterStatus, error) {
+	client, err := kube.NewClient(cfg.Kubernetes)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	st := &clusterStatus{UnhealthyPods: make(map[string][]kube.Pod)}
+
+	if st.Nodes, err = kube.Nodes(ctx, client); err != nil {
+		return nil, err
+	}
+	if st.ControlPlane, err = kube.ControlPlane(ctx, client); err != nil {
+		return nil, err
+	}
+
+	pods, err := kube.UnhealthyPods(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pods {
+		st.UnhealthyPods[p.Namespace] = append(st.UnhealthyPods[p.Namespace], p)
+	}
+
+	if st.PendingPVCs, err = kube.PendingPVCs(ctx, client); err != nil {
+		return nil, err
+	}
+
+	// Certificates are only readable on the nodes themselves. A node that
+	// can't be reached shouldn't hide the rest of the overview.
+	for _, node := range cfg.Kubernetes.Nodes {
+		nc := nodeCerts{Node: node.Name}
+
+		certs, err := kubeadmCerts(node)
+		if err != nil {
+			nc.Error = err.Error()
+		}
+		for _, c := range certs {
+			nc.Certificates = append(nc.Certificates, certStatus{
+				Name:              c.Name,
+				CA:                c.IsCA,
+				Expires:           c.ExpirationDate,
+				ExternallyManaged: c.ExternallyManaged,
+			})
+		}
+
+		st.Certificates = append(st.Certificates, nc)
+	}
+
+	return st, nil
+}
+
+func kubeadmCerts(node config.Node) ([]ssh.KubeadmCert, error) {
+	sshClient, err := ssh.Get(node)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: %w", err)
+	}
+	return sshClient.KubeadmCerts()
+}
+
+func printStatus(st *clusterStatus) {
+	fmt.Println("🖥️  Nodes")
+	t := table.New("NAME", "STATUS", "ROLES", "VERSION")
+	for _, n := range st.Nodes {
+		state := "NotReady"
+		if n.Ready {
+			state = "Ready"
+		}
+		roles := strings.Join(n.Roles, ",")
+		if roles == "" {
+			roles = "<none>"
+		}
+		t.AddRow(n.Name, state, roles, n.Version)
+	}
+	t.Print(os.Stdout)
+
+	fmt.Println()
+	if len(st.ControlPlane) == 0 {
+		fmt.Println("🧩 No control plane pods found")
+	} else {
+		fmt.Println("🧩 Control plane")
+		t = table.New("COMPONENT", "NODE", "STATUS")
+		for _, c := range st.ControlPlane {
+			state := "NotReady"
+			if c.Ready {
+				state = "Ready"
+			}
+			t.AddRow(c.Name, c.Node, state)
+		}
+		t.Print(os.Stdout)
+	}
+
+	fmt.Println()
+	if len(st.UnhealthyPods) == 0 {
+		fmt.Println("✅ All pods are running or completed")
+	} else {
+		fmt.Println("⚠️  Pods that are not running")
+		t = table.New("NAMESPACE", "NAME", "STATUS", "RESTARTS", "NODE")
+		for _, ns := range sortedKeys(st.UnhealthyPods) {
+			for _, p := range st.UnhealthyPods[ns] {
+				t.AddRow(p.Namespace, p.Name, p.Status, strconv.Itoa(int(p.Restarts)), p.Node)
+			}
+		}
+		t.Print(os.Stdout)
+	}
+
+	fmt.Println()
+	if len(st.PendingPVCs) == 0 {
+		fmt.Println("✅ No pending persistent volume claims")
+	} else {
+		fmt.Println("⚠️  Pending persistent volume claims")
+		t = table.New("NAMESPACE", "NAME", "STORAGECLASS")
+		for _, p := range st.PendingPVCs {
+			t.AddRow(p.Namespace, p.Name, p.StorageClass)
+		}
+		t.Print(os.Stdout)
+	}
+
+	fmt.Println()
+	fmt.Println("🔏 Certificates")
+	t = table.New("NODE", "CERTIFICATE", "EXPIRES", "RESIDUAL", "EXTERNAL")
+	for _, nc := range st.Certificates {
+		if nc.Error != "" {
+			t.AddRow(nc.Node, "-", nc.Error, "", "")
+			continue
+		}
+		for _, c := range nc.Certificates {
+			name := c.Name
+			if c.CA {
+				name += " (ca)"
+			}
+			external := "no"
+			if c.ExternallyManaged {
+				external = "yes"
+			}
+			t.AddRow(nc.Node, name, c.Expires.Local().Format(time.DateTime), residual(c.Expires), external)
+		}
+	}
+	t.Print(os.Stdout)
+}
+
+// residual returns time left until the certificate expires in days, and
+// flags certificates that expire soon.
+func residual(expires time.Time) string {
+	left := time.Until(expires)
+	switch {
+	case left <= 0:
+		return "expired"
+	case left < 24*time.Hour:
+		return "<1d ⚠️"
+	case left < certWarning:
+		return fmt.Sprintf("%dd ⚠️", int(left.Hours()/24))
+	default:
+		return fmt.Sprintf("%dd", int(left.Hours()/24))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
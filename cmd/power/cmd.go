@@ -0,0 +1,29 @@
+package power
+
+import "github.com/spf13/cobra"
+
+var (
+	flagAssumeYes bool
+	flagForce     bool
+)
+
+func Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "power",
+		Short:   "Control power of nodes",
+		Example: powerExample,
+	}
+
+	cmd.AddCommand(on)
+
+	off.Flags().BoolVarP(&flagAssumeYes, "assume-yes", "y", false, `assume "yes" as answer to all prompts`)
+	off.Flags().BoolVar(&flagForce, "force", false, "cut power instead of asking operating system to shut down")
+	cmd.AddCommand(off)
+
+	cycle.Flags().BoolVarP(&flagAssumeYes, "assume-yes", "y", false, `assume "yes" as answer to all prompts`)
+	cmd.AddCommand(cycle)
+
+	cmd.AddCommand(status)
+
+	return cmd
+}
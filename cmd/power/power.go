@@ -0,0 +1,193 @@
+package power
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/power"
+	"github.com/romantomjak/labctl/table"
+)
+
+// timeout applies to every request sent to a BMC.
+const timeout = 30 * time.Second
+
+var powerExample = strings.Trim(`
+  # Hard reset a node that stopped responding
+  labctl power cycle ceph2
+
+  # Show power state of all nodes
+  labctl power status
+`, "\n")
+
+var on = &cobra.Command{
+	Use:          "on [flags] <node>",
+	Short:        "Power node on",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return powerAction(args[0], "🔌 Powering on", "", func(ctx context.Context, d power.Driver) error {
+			return d.On(ctx)
+		})
+	},
+}
+
+var off = &cobra.Command{
+	Use:          "off [flags] <node>",
+	Short:        "Power node off",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return powerAction(args[0], "⚡️ Powering off", "❓ Power off %s? (y/n) [n] ", func(ctx context.Context, d power.Driver) error {
+			return d.Off(ctx, flagForce)
+		})
+	},
+}
+
+var cycle = &cobra.Command{
+	Use:          "cycle [flags] <node>",
+	Short:        "Hard reset node",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return powerAction(args[0], "♻️  Power cycling", "❓ Hard reset %s? (y/n) [n] ", func(ctx context.Context, d power.Driver) error {
+			return d.Cycle(ctx)
+		})
+	},
+}
+
+var status = &cobra.Command{
+	Use:          "status [flags] [node]...",
+	Short:        "Show power state of nodes",
+	SilenceUsage: true,
+	RunE:         statusCommandFunc,
+}
+
+func powerAction(name, message, confirm string, action func(context.Context, power.Driver) error) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	node, ok := cfg.FindNode(name)
+	if !ok {
+		return fmt.Errorf("node %q is not defined in configuration", name)
+	}
+
+	driver, err := power.New(cfg, node)
+	if err != nil {
+		return err
+	}
+
+	if confirm != "" && !flagAssumeYes {
+		answer, err := prompt(fmt.Sprintf(confirm, node.Name))
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			break // continue
+		default:
+			fmt.Println("🙅‍♀️ Aborted")
+			return nil
+		}
+	}
+
+	fmt.Printf("%s %s using %s\n", message, node.Name, driver.Name())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := action(ctx, driver); err != nil {
+		return fmt.Errorf("%s: %w", driver.Name(), err)
+	}
+
+	fmt.Println("✅ OK")
+
+	return nil
+}
+
+func statusCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	var nodes []config.Node
+	if len(args) == 0 {
+		// Only nodes that can be powered on can be checked.
+		for _, n := range slices.Concat(cfg.Ceph.Nodes, cfg.Kubernetes.Nodes) {
+			if n.BMC != nil || n.MAC != "" {
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	for _, name := range args {
+		node, ok := cfg.FindNode(name)
+		if !ok {
+			return fmt.Errorf("node %q is not defined in configuration", name)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 0 {
+		fmt.Println("No nodes with power control configured 🙅‍♀️")
+		return nil
+	}
+
+	// One unreachable BMC shouldn't hide the state of the other nodes, so
+	// errors are shown in the row of the node and reported at the end.
+	failed := 0
+	t := table.New("NODE", "DRIVER", "STATE")
+	for _, node := range nodes {
+		driver, err := power.New(cfg, node)
+		if err != nil {
+			failed++
+			t.AddRow(node.Name, "-", err.Error())
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		state, err := driver.Status(ctx)
+		cancel()
+
+		s := string(state)
+		if err != nil {
+			failed++
+			s = err.Error()
+		}
+
+		t.AddRow(node.Name, driver.Name(), s)
+	}
+
+	if err := t.Print(cmd.OutOrStdout()); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to get power state of %d of %d nodes", failed, len(nodes))
+	}
+
+	return nil
+}
+
+func prompt(prompt string) (string, error) {
+	fmt.Fprint(os.Stdout, prompt)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read input: %w", err)
+	}
+
+	return scanner.Text(), nil
+}
@@ -0,0 +1,17 @@
+package ssh
+
+import "github.com/spf13/cobra"
+
+var flagAssumeYes bool
+
+func Command() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ssh",
+		Short: "Manage SSH connections to nodes",
+	}
+
+	trust.Flags().BoolVarP(&flagAssumeYes, "assume-yes", "y", false, `assume "yes" as answer to all prompts`)
+	cmd.AddCommand(trust)
+
+	return cmd
+}
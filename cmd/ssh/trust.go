@@ -0,0 +1,105 @@
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	cryptossh "golang.org/x/crypto/ssh"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/ssh"
+)
+
+const (
+	Reset       = "\033[0m"
+	BrightBlack = "\033[90m"
+)
+
+var trustExample = strings.Trim(`
+  # Add host key of a node to known_hosts
+  labctl ssh trust ceph1
+`, "\n")
+
+var trust = &cobra.Command{
+	Use:          "trust [flags] <node>",
+	Short:        "Add host key of node to known_hosts",
+	Example:      trustExample,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE:         trustCommandFunc,
+}
+
+func trustCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	node, ok := cfg.FindNode(args[0])
+	if !ok {
+		return fmt.Errorf("node %q is not defined in configuration", args[0])
+	}
+
+	// Configured host keys take precedence, so known_hosts is never
+	// consulted for such nodes.
+	if node.HostKey != "" || len(node.HostKeys) > 0 {
+		return fmt.Errorf("%s has host_key configured, known_hosts is not used for it", node.Name)
+	}
+
+	fmt.Printf("🔍 Scanning host key of %s\n", node.Name)
+
+	key, err := ssh.ScanHostKey(node)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(BrightBlack + " ↳ " + key.Type() + " " + cryptossh.FingerprintSHA256(key) + Reset)
+
+	known, err := ssh.IsKnownHost(node, key)
+	if err != nil {
+		return err
+	}
+	if known {
+		fmt.Printf("✅ %s is already trusted\n", node.Name)
+		return nil
+	}
+
+	if !flagAssumeYes {
+		answer, err := prompt(fmt.Sprintf("❓ Trust this key for %s? (y/n) [n] ", node.Name))
+		if err != nil {
+			return err
+		}
+
+		switch strings.ToLower(answer) {
+		case "y", "yes":
+			break // continue
+		default:
+			fmt.Println("🙅‍♀️ Not trusting the key")
+			return nil
+		}
+	}
+
+	if err := ssh.TrustHostKey(node, key); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Added %s to %s\n", node.Name, ssh.KnownHostsFile)
+
+	return nil
+}
+
+func prompt(prompt string) (string, error) {
+	fmt.Fprint(os.Stdout, prompt)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read input: %w", err)
+	}
+
+	return scanner.Text(), nil
+}
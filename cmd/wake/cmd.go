@@ -0,0 +1,19 @@
+package wake
+
+import "github.com/spf13/cobra"
+
+var (
+	flagBroadcast string
+	flagInterface string
+	flagRepeat    int
+	flagPassword  string
+)
+
+func Command() *cobra.Command {
+	wake.Flags().StringVar(&flagBroadcast, "broadcast", "", `address to send packets to, e.g. "10.10.0.255:9"`)
+	wake.Flags().StringVar(&flagInterface, "interface", "", "local network interface to send packets from")
+	wake.Flags().IntVar(&flagRepeat, "repeat", 0, "how many times to send each packet")
+	wake.Flags().StringVar(&flagPassword, "password", "", "SecureOn password in MAC or IPv4 format")
+
+	return wake
+}
@@ -0,0 +1,81 @@
+package wake
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/wakeonlan"
+)
+
+var wakeExample = strings.Trim(`
+  # Wake up a node from configuration file
+  labctl wake ceph1
+
+  # Wake up any computer on the network
+  labctl wake 01:23:45:67:89:ab
+
+  # Send packets to a different subnet
+  labctl wake --broadcast 10.10.0.255:9 ceph1
+`, "\n")
+
+var wake = &cobra.Command{
+	Use:          "wake [flags] <node|mac>...",
+	Short:        "Wake up nodes using Wake-on-LAN",
+	Example:      wakeExample,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE:         wakeCommandFunc,
+}
+
+func wakeCommandFunc(cmd *cobra.Command, args []string) error {
+	cfg, err := config.FromFile("~/.labctl.hcl")
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	// Resolve all nodes before sending anything, so that a typo doesn't
+	// leave some of the nodes running and others not.
+	nodes := make([]config.Node, 0, len(args))
+	for _, arg := range args {
+		node, ok := cfg.FindNode(arg)
+		if !ok {
+			if _, err := net.ParseMAC(arg); err != nil {
+				return fmt.Errorf("%q is neither a configured node nor a mac address", arg)
+			}
+			node = config.Node{Name: arg, MAC: arg}
+		}
+		nodes = append(nodes, node)
+	}
+
+	fmt.Println("📡 Sending Wake-on-LAN packets")
+
+	for _, node := range nodes {
+		if flagBroadcast != "" {
+			node.WOLBroadcast = flagBroadcast
+		}
+		if flagInterface != "" {
+			node.WOLInterface = flagInterface
+		}
+		if flagRepeat > 0 {
+			node.WOLRepeat = flagRepeat
+		}
+		if flagPassword != "" {
+			node.WOLPassword = flagPassword
+		}
+
+		fmt.Printf("  - %s... ", node.Name)
+
+		if err := wakeonlan.Wake(cfg, node); err != nil {
+			fmt.Println("❌")
+			return fmt.Errorf("wake on lan: %w", err)
+		}
+
+		fmt.Println("OK ✅")
+	}
+
+	return nil
+}
@@ -1,57 +1,270 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"net"
 	"os"
+	"os/user"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
 )
 
 type Config struct {
+	// SSHConfig is optional. When set, it must point to an OpenSSH client
+	// configuration file, e.g. "~/.ssh/config", that is used to fill in
+	// HostName, User, Port, IdentityFile and ProxyJump of nodes that don't
+	// set them.
+	SSHConfig string `hcl:"ssh_config,optional"`
+
 	Kubernetes Kubernetes `hcl:"kubernetes,block"`
 	Proxmox    Proxmox    `hcl:"proxmox,block"`
 	Ceph       Ceph       `hcl:"ceph,block"`
+
+	// S3 is optional. It configures access to S3-compatible storage that
+	// backups are written to with s3:// URLs.
+	S3 *S3 `hcl:"s3,block"`
+}
+
+type S3 struct {
+	// Endpoint is optional, e.g. "http://minio.lan:9000". Defaults to
+	// AWS_ENDPOINT_URL environment variable, or AWS S3.
+	Endpoint string `hcl:"endpoint,optional"`
+
+	// Region is optional. Defaults to AWS_REGION environment variable.
+	Region string `hcl:"region,optional"`
+
+	// AccessKey and SecretKey are optional. Default to AWS_ACCESS_KEY_ID
+	// and AWS_SECRET_ACCESS_KEY environment variables, or the default
+	// profile in ~/.aws/credentials.
+	AccessKey string `hcl:"access_key,optional"`
+	SecretKey string `hcl:"secret_key,optional"`
 }
 
 type Ceph struct {
 	Release string `hcl:"release"`
 	Cephadm string `hcl:"cephadm"`
-	Nodes   []Node `hcl:"node,block"`
+
+	// CephadmSHA256 is optional. It maps releases to checksums of their
+	// cephadm binary, e.g. { "19.2.2" = "4c8e...d0f1" }. When set, the
+	// downloaded binary must match the checksum of the release before it
+	// is installed.
+	CephadmSHA256 map[string]string `hcl:"cephadm_sha256,optional"`
+
+	// CephadmSigningKey is optional. When set, it must point to an ASCII
+	// armored public key that was used to create a detached signature
+	// published next to the binary with an ".asc" extension.
+	CephadmSigningKey string `hcl:"cephadm_signing_key,optional"`
+
+	// Mirror is optional. It can be used to download cephadm from a local
+	// mirror in air-gapped labs, e.g. "http://mirror.lan/ceph" or
+	// "file:///srv/mirror/ceph". Defaults to https://download.ceph.com.
+	Mirror string `hcl:"mirror,optional"`
+
+	// Timeouts are optional and control how long to wait for each phase
+	// of booting or shutting down the cluster.
+	SSHWaitRaw      string `hcl:"ssh_wait,optional"`
+	SSHWait         time.Duration
+	ServicesWaitRaw string `hcl:"services_wait,optional"`
+	ServicesWait    time.Duration
+	HealthWaitRaw   string `hcl:"health_wait,optional"`
+	HealthWait      time.Duration
+	DaemonStopRaw   string `hcl:"daemon_stop,optional"`
+	DaemonStop      time.Duration
+	PowerOffWaitRaw string `hcl:"power_off_wait,optional"`
+	PowerOffWait    time.Duration
+	DrainWaitRaw    string `hcl:"drain_wait,optional"`
+	DrainWait       time.Duration
+	UpgradeWaitRaw  string `hcl:"upgrade_wait,optional"`
+	UpgradeWait     time.Duration
+
+	Nodes []Node `hcl:"node,block"`
 }
 
 type Kubernetes struct {
+	// Name is optional. It is recorded in backup manifests and used in
+	// backup file names. Defaults to "kubernetes".
+	Name string `hcl:"name,optional"`
+
+	// Kubeconfig and Context are optional. They select the cluster API
+	// requests are sent to and default to the ones kubectl uses.
+	Kubeconfig string `hcl:"kubeconfig,optional"`
+	Context    string `hcl:"context,optional"`
+
 	Dashboard KubernetesDashboard `hcl:"dashboard,block"`
-	Node      Node                `hcl:"node,block"`
+
+	// Backup is optional.
+	Backup *Backup `hcl:"backup,block"`
+
+	// Etcd is optional. Defaults match clusters created with kubeadm.
+	Etcd *Etcd `hcl:"etcd,block"`
+
+	// Nodes are the control plane nodes. At least one is required.
+	Nodes []Node `hcl:"node,block"`
+}
+
+type Etcd struct {
+	// Etcdctl and Etcdutl are paths to the binaries on the control plane
+	// nodes. Default to "etcdctl" and "etcdutl".
+	Etcdctl string `hcl:"etcdctl,optional"`
+	Etcdutl string `hcl:"etcdutl,optional"`
+
+	// Endpoint is the client URL of the local etcd member. Defaults to
+	// "https://127.0.0.1:2379".
+	Endpoint string `hcl:"endpoint,optional"`
+
+	// Certificates for connecting to etcd. Default to kubeadm paths under
+	// /etc/kubernetes/pki/etcd, for k3s they are under
+	// /var/lib/rancher/k3s/server/tls/etcd.
+	CACert string `hcl:"cacert,optional"`
+	Cert   string `hcl:"cert,optional"`
+	Key    string `hcl:"key,optional"`
+}
+
+type Backup struct {
+	// Dir is optional. It is where `k8s backup` stores timestamped
+	// snapshots when no filename is given. It is either a local directory,
+	// or a URL, e.g. "s3://bucket/prefix" or "sftp://nas/backups", where
+	// host of sftp URLs is a node from this file or [user@]host[:port].
+	Dir string `hcl:"dir,optional"`
+
+	// Retention rules are optional. After each backup to Dir, the newest
+	// snapshot in each of the last KeepHourly hours, KeepDaily days and
+	// KeepWeekly weeks is kept and the rest are removed. If none are set,
+	// all snapshots are kept.
+	KeepHourly int `hcl:"keep_hourly,optional"`
+	KeepDaily  int `hcl:"keep_daily,optional"`
+	KeepWeekly int `hcl:"keep_weekly,optional"`
+
+	// Recipients is optional. When set, backups are encrypted to these
+	// age recipients, e.g. "age1...", or SSH public keys.
+	Recipients []string `hcl:"recipients,optional"`
+
+	// IdentityFile is optional. It is the age identity file, or an SSH
+	// private key, used to decrypt backups encrypted to Recipients.
+	IdentityFile string `hcl:"identity_file,optional"`
+
+	// Passphrase is optional. When set, backups are encrypted with a
+	// passphrase, which is read from LABCTL_BACKUP_PASSPHRASE environment
+	// variable or prompted for. Can't be used together with Recipients.
+	Passphrase bool `hcl:"passphrase,optional"`
 }
 
 type Node struct {
-	Name     string `hcl:"name,label"`
-	Addr     string `hcl:"addr"`
-	Username string `hcl:"username"`
+	Name string `hcl:"name,label"`
 
-	// Password is required if private key is not set.
+	// Addr and Username are required unless they are read from SSHConfig.
+	// Addr defaults to the node name on port 22 if SSHConfig is set.
+	Addr     string `hcl:"addr,optional"`
+	Username string `hcl:"username,optional"`
+
+	// Password is optional. It is used for password and keyboard-interactive
+	// authentication, and for proxmox API.
 	Password string `hcl:"password,optional"`
 
-	// PrivateKeyFile is required if password is not set.
+	// PrivateKeyFile is optional. Encrypted keys prompt for a passphrase and
+	// a certificate is used if one exists next to the key as <key>-cert.pub.
 	PrivateKeyFile string `hcl:"private_key_file,optional"`
 
-	// HostKey is required if password is not set.
+	// PrivateKeyFiles is optional and works like PrivateKeyFile, but allows
+	// to offer multiple keys.
+	PrivateKeyFiles []string `hcl:"private_key_files,optional"`
+
+	// AuthMethods is optional. It sets the order SSH auth methods are tried
+	// in. Supported methods are "agent", "publickey", "password" and
+	// "keyboard-interactive". Defaults to all of them in that order, but
+	// password is only prompted for if it is explicitly listed.
+	AuthMethods []string `hcl:"auth_methods,optional"`
+
+	// HostKey is optional. If neither HostKey nor HostKeys are set, host
+	// keys are looked up in ~/.ssh/known_hosts.
 	//
 	// A supported ECDH256 hash can be obtained using:
 	//   ssh-keyscan <host>
 	HostKey string `hcl:"host_key,optional"`
 
+	// HostKeys is optional and works like HostKey, but allows to accept
+	// multiple keys, e.g. one of each key type.
+	HostKeys []string `hcl:"host_keys,optional"`
+
+	// TrustOnFirstUse is optional. If set, host key of a node that is not
+	// in known_hosts is added there on first connection. Changed keys are
+	// always rejected.
+	TrustOnFirstUse bool `hcl:"trust_on_first_use,optional"`
+
+	// ProxyJump is optional. It is a comma separated list of jump hosts the
+	// connection is tunneled through, in order. Each jump host is either the
+	// name of a node from this file, or [user@]host[:port]. Jump hosts may
+	// have their own ProxyJump, which is followed.
+	ProxyJump string `hcl:"proxy_jump,optional"`
+
+	// Jumps are the nodes resolved from ProxyJump, in the order they must
+	// be connected through.
+	Jumps []Node
+
 	// MAC address is optional. This is used to boot nodes
 	// using Wake-on-Lan (WOL) magic packets.
 	MAC string `hcl:"mac,optional"`
+
+	// WOLBroadcast is optional. It is the address Wake-on-LAN packets are
+	// sent to, e.g. a directed broadcast address "10.10.0.255:9".
+	WOLBroadcast string `hcl:"wol_broadcast,optional"`
+
+	// WOLInterface is optional. It is the name of the local network
+	// interface Wake-on-LAN packets are sent from.
+	WOLInterface string `hcl:"wol_interface,optional"`
+
+	// WOLRepeat is optional. It is how many times each Wake-on-LAN packet
+	// is sent.
+	WOLRepeat int `hcl:"wol_repeat,optional"`
+
+	// WOLVia is optional. It is the name of an always-on node that
+	// Wake-on-LAN packets are sent from over SSH, for nodes on networks
+	// that can't be reached with broadcasts from the local machine.
+	WOLVia string `hcl:"wol_via,optional"`
+
+	// WOLPassword is optional. It is the SecureOn password of the network
+	// card, e.g. "01:23:45:67:89:ab".
+	WOLPassword string `hcl:"wol_password,optional"`
+
+	// BMC is optional. It is used for out-of-band power control, so that
+	// nodes can be powered on and off even when they are not responding.
+	BMC *BMC `hcl:"bmc,block"`
+}
+
+type BMC struct {
+	// Driver is one of "ipmi", "redfish" or "wol".
+	Driver   string `hcl:"driver"`
+	Addr     string `hcl:"addr,optional"`
+	Username string `hcl:"username,optional"`
+	Password string `hcl:"password,optional"`
+
+	// Insecure disables TLS certificate verification for redfish.
+	Insecure bool `hcl:"insecure,optional"`
 }
 
 type KubernetesDashboard struct {
 	Namespace string `hcl:"namespace"`
 	User      string `hcl:"user"`
 	URL       string `hcl:"url"`
+
+	// Audiences are optional. They are the intended audiences of the
+	// token and default to the audience of the API server.
+	Audiences []string `hcl:"audiences,optional"`
+
+	// Expiration is optional, e.g. "8h". It is how long the token is valid
+	// for and defaults to an hour. It must be at least 10 minutes, API
+	// server may shorten it.
+	ExpirationRaw string `hcl:"expiration,optional"`
+	Expiration    time.Duration
 }
 
 type Proxmox struct {
@@ -61,12 +274,9 @@ type Proxmox struct {
 }
 
 func FromFile(filename string) (*Config, error) {
-	if strings.HasPrefix(filename, "~") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("get home directory: %w", err)
-		}
-		filename = strings.Replace(filename, "~", home, 1)
+	filename, err := ExpandTilde(filename)
+	if err != nil {
+		return nil, err
 	}
 
 	cfg := &Config{}
@@ -81,5 +291,391 @@ func FromFile(filename string) (*Config, error) {
 
 	cfg.Proxmox.Timeout = timeout
 
+	cephTimeouts := []struct {
+		name     string
+		raw      string
+		value    *time.Duration
+		fallback time.Duration
+	}{
+		{"ssh_wait", cfg.Ceph.SSHWaitRaw, &cfg.Ceph.SSHWait, 5 * time.Minute},
+		{"services_wait", cfg.Ceph.ServicesWaitRaw, &cfg.Ceph.ServicesWait, 5 * time.Minute},
+		{"health_wait", cfg.Ceph.HealthWaitRaw, &cfg.Ceph.HealthWait, 5 * time.Minute},
+		{"daemon_stop", cfg.Ceph.DaemonStopRaw, &cfg.Ceph.DaemonStop, 30 * time.Second},
+		{"power_off_wait", cfg.Ceph.PowerOffWaitRaw, &cfg.Ceph.PowerOffWait, 30 * time.Second},
+		{"drain_wait", cfg.Ceph.DrainWaitRaw, &cfg.Ceph.DrainWait, 24 * time.Hour},
+		{"upgrade_wait", cfg.Ceph.UpgradeWaitRaw, &cfg.Ceph.UpgradeWait, 12 * time.Hour},
+	}
+
+	for _, t := range cephTimeouts {
+		*t.value = t.fallback
+		if t.raw == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(t.raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", t.name, err)
+		}
+		*t.value = d
+	}
+
+	if len(cfg.Kubernetes.Nodes) == 0 {
+		return nil, fmt.Errorf("at least one kubernetes node is required")
+	}
+
+	cfg.Kubernetes.Dashboard.Expiration = time.Hour
+	if raw := cfg.Kubernetes.Dashboard.ExpirationRaw; raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse dashboard expiration: %w", err)
+		}
+		cfg.Kubernetes.Dashboard.Expiration = d
+	}
+
+	cfg.Kubernetes.Kubeconfig, err = ExpandTilde(cfg.Kubernetes.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Kubernetes.Name == "" {
+		cfg.Kubernetes.Name = "kubernetes"
+	}
+
+	if cfg.S3 == nil {
+		cfg.S3 = &S3{}
+	}
+
+	if cfg.Kubernetes.Backup == nil {
+		cfg.Kubernetes.Backup = &Backup{}
+	}
+
+	cfg.Kubernetes.Backup.Dir, err = ExpandTilde(cfg.Kubernetes.Backup.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Kubernetes.Backup.IdentityFile, err = ExpandTilde(cfg.Kubernetes.Backup.IdentityFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Kubernetes.Backup.Passphrase && len(cfg.Kubernetes.Backup.Recipients) > 0 {
+		return nil, fmt.Errorf("backup passphrase and recipients can't be used together")
+	}
+
+	if cfg.Kubernetes.Etcd == nil {
+		cfg.Kubernetes.Etcd = &Etcd{}
+	}
+
+	etcdDefaults := []struct {
+		value    *string
+		fallback string
+	}{
+		{&cfg.Kubernetes.Etcd.Etcdctl, "etcdctl"},
+		{&cfg.Kubernetes.Etcd.Etcdutl, "etcdutl"},
+		{&cfg.Kubernetes.Etcd.Endpoint, "https://127.0.0.1:2379"},
+		{&cfg.Kubernetes.Etcd.CACert, "/etc/kubernetes/pki/etcd/ca.crt"},
+		{&cfg.Kubernetes.Etcd.Cert, "/etc/kubernetes/pki/etcd/server.crt"},
+		{&cfg.Kubernetes.Etcd.Key, "/etc/kubernetes/pki/etcd/server.key"},
+	}
+
+	for _, d := range etcdDefaults {
+		if *d.value == "" {
+			*d.value = d.fallback
+		}
+	}
+
+	if err := cfg.resolveSSH(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
+
+// resolveSSH applies SSHConfig to nodes and resolves their jump hosts.
+// Proxmox nodes are API endpoints, so only their jump hosts are resolved.
+func (c *Config) resolveSSH() error {
+	var sshCfg *sshConfig
+	if c.SSHConfig != "" {
+		var err error
+		sshCfg, err = readSSHConfig(c.SSHConfig)
+		if err != nil {
+			return fmt.Errorf("read ssh config: %w", err)
+		}
+
+		for i := range c.Kubernetes.Nodes {
+			sshCfg.apply(&c.Kubernetes.Nodes[i])
+		}
+		for i := range c.Ceph.Nodes {
+			sshCfg.apply(&c.Ceph.Nodes[i])
+		}
+	}
+
+	// Proxmox nodes aren't looked up in SSH config, so they must set both.
+	for _, n := range slices.Concat(c.Kubernetes.Nodes, c.Ceph.Nodes) {
+		if n.Addr == "" || n.Username == "" {
+			return fmt.Errorf("node %s has no addr or username, set them or add the node to ssh config", n.Name)
+		}
+	}
+	for _, n := range c.Proxmox.Nodes {
+		if n.Addr == "" || n.Username == "" {
+			return fmt.Errorf("proxmox node %s has no addr or username", n.Name)
+		}
+	}
+
+	var nodes []*Node
+	for i := range c.Kubernetes.Nodes {
+		nodes = append(nodes, &c.Kubernetes.Nodes[i])
+	}
+	for i := range c.Proxmox.Nodes {
+		nodes = append(nodes, &c.Proxmox.Nodes[i])
+	}
+	for i := range c.Ceph.Nodes {
+		nodes = append(nodes, &c.Ceph.Nodes[i])
+	}
+
+	for _, n := range nodes {
+		jumps, err := c.resolveJumps(sshCfg, *n, map[string]bool{strings.ToLower(n.Name): true})
+		if err != nil {
+			return fmt.Errorf("proxy_jump of %s: %w", n.Name, err)
+		}
+		n.Jumps = jumps
+	}
+
+	return nil
+}
+
+// resolveJumps returns all nodes that must be connected through to reach
+// the node, following ProxyJump of jump hosts themselves.
+func (c *Config) resolveJumps(sshCfg *sshConfig, node Node, seen map[string]bool) ([]Node, error) {
+	if node.ProxyJump == "" {
+		return nil, nil
+	}
+
+	var jumps []Node
+	for _, spec := range strings.Split(node.ProxyJump, ",") {
+		spec = strings.TrimSpace(spec)
+
+		jump, ok := c.FindNode(spec)
+		if !ok {
+			jump = jumpNode(sshCfg, spec, node.Username)
+		}
+
+		key := strings.ToLower(jump.Name)
+		if seen[key] {
+			return nil, fmt.Errorf("%s is part of a loop", jump.Name)
+		}
+		seen[key] = true
+
+		parents, err := c.resolveJumps(sshCfg, jump, seen)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only nodes on the current path form a loop, different jump hosts
+		// may share their own jump hosts.
+		delete(seen, key)
+
+		jump.Jumps = nil
+		jumps = append(jumps, parents...)
+		jumps = append(jumps, jump)
+	}
+
+	return jumps, nil
+}
+
+// jumpNode creates a node from [user@]host[:port], looking up the host in
+// SSH config if there is one. Username defaults to the one of the node
+// that is being connected to.
+func jumpNode(sshCfg *sshConfig, spec, username string) Node {
+	var jump Node
+
+	if user, host, ok := strings.Cut(spec, "@"); ok {
+		jump.Username, spec = user, host
+	}
+
+	jump.Name = spec
+	if host, _, err := net.SplitHostPort(spec); err == nil {
+		jump.Name = host
+		jump.Addr = spec
+	}
+
+	if sshCfg != nil {
+		sshCfg.apply(&jump)
+	}
+
+	if jump.Addr == "" {
+		jump.Addr = net.JoinHostPort(jump.Name, "22")
+	}
+	if jump.Username == "" {
+		jump.Username = username
+	}
+
+	return jump
+}
+
+// ResolveNode returns a node with the given name, or creates one from
+// [user@]host[:port] the same way jump hosts are, e.g. for a NAS backups
+// are written to. Username defaults to the local user.
+func (c *Config) ResolveNode(spec string) (Node, error) {
+	if node, ok := c.FindNode(spec); ok {
+		return node, nil
+	}
+
+	var sshCfg *sshConfig
+	if c.SSHConfig != "" {
+		var err error
+		sshCfg, err = readSSHConfig(c.SSHConfig)
+		if err != nil {
+			return Node{}, fmt.Errorf("read ssh config: %w", err)
+		}
+	}
+
+	local, err := user.Current()
+	if err != nil {
+		return Node{}, fmt.Errorf("get current user: %w", err)
+	}
+
+	node := jumpNode(sshCfg, spec, local.Username)
+
+	jumps, err := c.resolveJumps(sshCfg, node, map[string]bool{strings.ToLower(node.Name): true})
+	if err != nil {
+		return Node{}, fmt.Errorf("proxy_jump of %s: %w", node.Name, err)
+	}
+	node.Jumps = jumps
+
+	return node, nil
+}
+
+// FindNode returns a node with the given name from any section of the
+// configuration.
+func (c *Config) FindNode(name string) (Node, bool) {
+	nodes := slices.Concat(c.Kubernetes.Nodes, c.Proxmox.Nodes)
+	nodes = append(nodes, c.Ceph.Nodes...)
+
+	for _, n := range nodes {
+		if n.Name != "" && strings.EqualFold(n.Name, name) {
+			return n, true
+		}
+	}
+
+	return Node{}, false
+}
+
+// cephReleaseRegexp matches ceph releases, e.g. "19.2.3".
+var cephReleaseRegexp = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+// ValidateCephRelease returns an error unless the release is a ceph
+// release version, e.g. "19.2.3".
+func ValidateCephRelease(release string) error {
+	if !cephReleaseRegexp.MatchString(release) {
+		return fmt.Errorf("%q is not a valid ceph release", release)
+	}
+	return nil
+}
+
+// SetCephRelease updates the ceph release in the configuration file while
+// preserving the rest of the file, including comments and formatting.
+func SetCephRelease(filename, release string) error {
+	if err := ValidateCephRelease(release); err != nil {
+		return err
+	}
+
+	filename, err := ExpandTilde(filename)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("read file: %w", err)
+	}
+
+	// hclwrite reindents the whole file, so only the release expression is
+	// replaced in the source instead.
+	f, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("parse file: %w", diags)
+	}
+
+	var block *hclsyntax.Block
+	for _, b := range f.Body.(*hclsyntax.Body).Blocks {
+		if b.Type == "ceph" {
+			block = b
+			break
+		}
+	}
+	if block == nil {
+		return fmt.Errorf("ceph block is not defined")
+	}
+
+	value := hclwrite.TokensForValue(cty.StringVal(release)).Bytes()
+
+	var start, end int
+	if attr, ok := block.Body.Attributes["release"]; ok {
+		start, end = attr.Expr.Range().Start.Byte, attr.Expr.Range().End.Byte
+	} else {
+		// Added as the first attribute of the block.
+		start = block.OpenBraceRange.End.Byte
+		end = start
+		value = fmt.Appendf(nil, "\n%srelease = %s", bodyIndent(src, block), value)
+		if block.CloseBraceRange.Start.Line == block.OpenBraceRange.Start.Line {
+			value = fmt.Appendf(value, "\n%s", lineIndent(src, block.TypeRange.Start.Byte))
+		}
+	}
+
+	out := slices.Concat(src[:start], value, src[end:])
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("stat file: %w", err)
+	}
+
+	if err := os.WriteFile(filename, out, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+
+	return nil
+}
+
+// bodyIndent returns indentation used in the body of the block, judging by
+// its first item. Empty body is indented by two spaces more than the block.
+func bodyIndent(src []byte, block *hclsyntax.Block) string {
+	var first hcl.Range
+	for _, attr := range block.Body.Attributes {
+		if first.Empty() || attr.SrcRange.Start.Byte < first.Start.Byte {
+			first = attr.SrcRange
+		}
+	}
+	for _, b := range block.Body.Blocks {
+		if first.Empty() || b.TypeRange.Start.Byte < first.Start.Byte {
+			first = b.TypeRange
+		}
+	}
+	if first.Empty() || first.Start.Line == block.OpenBraceRange.Start.Line {
+		return lineIndent(src, block.TypeRange.Start.Byte) + "  "
+	}
+	return lineIndent(src, first.Start.Byte)
+}
+
+// lineIndent returns whitespace the line containing the offset starts with.
+func lineIndent(src []byte, offset int) string {
+	start := bytes.LastIndexByte(src[:offset], '\n') + 1
+	line := src[start:offset]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// ExpandTilde replaces leading "~" in the filename with home directory of
+// the current user.
+func ExpandTilde(filename string) (string, error) {
+	if !strings.HasPrefix(filename, "~") {
+		return filename, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("get home directory: %w", err)
+	}
+
+	return strings.Replace(filename, "~", home, 1), nil
+}
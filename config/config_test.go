@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetCephRelease(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		release string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "replaces release",
+			src: `# Lab cluster.
+ceph {
+    # Upgraded by labctl.
+    release = "19.2.2"
+
+    node "ceph1" {
+        addr = "10.10.0.20:22"
+    }
+}
+`,
+			release: "19.2.3",
+			want: `# Lab cluster.
+ceph {
+    # Upgraded by labctl.
+    release = "19.2.3"
+
+    node "ceph1" {
+        addr = "10.10.0.20:22"
+    }
+}
+`,
+		},
+		{
+			name: "adds release",
+			src: `ceph {
+  timeout = "5m"
+}
+`,
+			release: "19.2.3",
+			want: `ceph {
+  release = "19.2.3"
+  timeout = "5m"
+}
+`,
+		},
+		{
+			name: "adds release with indentation of the block",
+			src: `ceph {
+    node "ceph1" {
+        addr = "10.10.0.20:22"
+    }
+}
+`,
+			release: "19.2.3",
+			want: `ceph {
+    release = "19.2.3"
+    node "ceph1" {
+        addr = "10.10.0.20:22"
+    }
+}
+`,
+		},
+		{
+			name: "adds release to empty block",
+			src: `ceph {
+}
+`,
+			release: "19.2.3",
+			want: `ceph {
+  release = "19.2.3"
+}
+`,
+		},
+		{
+			name:    "adds release to one line block",
+			src:     "ceph {}\n",
+			release: "19.2.3",
+			want: `ceph {
+  release = "19.2.3"
+}
+`,
+		},
+		{
+			name: "invalid release",
+			src: `ceph {
+  release = "19.2.2"
+}
+`,
+			release: "19.2.3; reboot",
+			wantErr: true,
+		},
+		{
+			name: "no ceph block",
+			src: `kubernetes {
+}
+`,
+			release: "19.2.3",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "labctl.hcl")
+			if err := os.WriteFile(filename, []byte(tt.src), 0o640); err != nil {
+				t.Fatal(err)
+			}
+
+			err := SetCephRelease(filename, tt.release)
+			if tt.wantErr && err == nil {
+				t.Error("expected error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.want
+			if tt.wantErr {
+				want = tt.src
+			}
+			if got := string(b); got != want {
+				t.Errorf("file is\n%s\nwant\n%s", got, want)
+			}
+
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0o640 {
+				t.Errorf("file mode is %o, want %o", info.Mode().Perm(), 0o640)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"strings"
+)
+
+// sshConfig holds Host sections of an OpenSSH client configuration file.
+// Only options that labctl can use are kept, the rest are ignored.
+type sshConfig struct {
+	hosts []sshHost
+}
+
+type sshHost struct {
+	patterns      []string
+	hostName      string
+	user          string
+	port          string
+	identityFiles []string
+	proxyJump     string
+}
+
+// readSSHConfig parses the file at filename. Match blocks are skipped and
+// Include directives are not followed.
+func readSSHConfig(filename string) (*sshConfig, error) {
+	filename, err := ExpandTilde(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Options before the first Host apply to all hosts.
+	current := &sshHost{patterns: []string{"*"}}
+	c := &sshConfig{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Keyword and value are separated by whitespace or "=".
+		i := strings.IndexAny(line, " \t=")
+		if i < 0 {
+			continue
+		}
+		keyword, value := line[:i], strings.TrimLeft(line[i:], " \t=")
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+
+		switch keyword {
+		case "host":
+			c.hosts = append(c.hosts, *current)
+			current = &sshHost{patterns: strings.Fields(value)}
+		case "match":
+			c.hosts = append(c.hosts, *current)
+			current = &sshHost{} // never matches
+		case "hostname":
+			current.hostName = value
+		case "user":
+			current.user = value
+		case "port":
+			current.port = value
+		case "identityfile":
+			current.identityFiles = append(current.identityFiles, value)
+		case "proxyjump":
+			current.proxyJump = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ssh config: %w", err)
+	}
+
+	c.hosts = append(c.hosts, *current)
+
+	return c, nil
+}
+
+// lookup returns options for the alias. Like OpenSSH, the first value
+// found for each option wins.
+func (c *sshConfig) lookup(alias string) sshHost {
+	var h sshHost
+	for _, host := range c.hosts {
+		if !matchHost(host.patterns, alias) {
+			continue
+		}
+
+		if h.hostName == "" {
+			h.hostName = host.hostName
+		}
+		if h.user == "" {
+			h.user = host.user
+		}
+		if h.port == "" {
+			h.port = host.port
+		}
+		if h.proxyJump == "" {
+			h.proxyJump = host.proxyJump
+		}
+		h.identityFiles = append(h.identityFiles, host.identityFiles...)
+	}
+
+	h.hostName = strings.ReplaceAll(h.hostName, "%h", alias)
+
+	return h
+}
+
+// apply fills in connection settings that the node doesn't set itself.
+func (c *sshConfig) apply(node *Node) {
+	h := c.lookup(node.Name)
+
+	if node.Addr == "" {
+		host := h.hostName
+		if host == "" {
+			host = node.Name
+		}
+		port := h.port
+		if port == "" {
+			port = "22"
+		}
+		node.Addr = net.JoinHostPort(host, port)
+	}
+
+	if node.Username == "" {
+		node.Username = h.user
+	}
+
+	if node.PrivateKeyFile == "" && len(node.PrivateKeyFiles) == 0 {
+		node.PrivateKeyFiles = h.identityFiles
+	}
+
+	if node.ProxyJump == "" && h.proxyJump != "none" {
+		node.ProxyJump = h.proxyJump
+	}
+}
+
+// matchHost matches the alias against Host patterns. Negated patterns
+// take precedence over all others.
+func matchHost(patterns []string, alias string) bool {
+	matched := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+
+		ok, _ := path.Match(strings.ToLower(p), strings.ToLower(alias))
+		if !ok {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
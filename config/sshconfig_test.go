@@ -0,0 +1,166 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSSHConfig = `# Defaults before the first Host apply to every host.
+IdentityFile ~/.ssh/id_ed25519
+
+Host bastion
+    HostName 203.0.113.10
+    User jump
+    ProxyJump none
+
+Host k8s-* !k8s-control-2
+    HostName %h.lab.internal
+    User=admin
+    Port = 2222
+    IdentityFile "~/.ssh/lab key"
+    ProxyJump bastion
+
+Match host k8s-*
+    User nobody
+
+Host *
+    User fallback
+    Port 22
+`
+
+func TestSSHConfigLookup(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(filename, []byte(testSSHConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := readSSHConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alias string
+		want  sshHost
+	}{
+		{
+			alias: "k8s-control-1",
+			want: sshHost{
+				hostName:      "k8s-control-1.lab.internal",
+				user:          "admin",
+				port:          "2222",
+				identityFiles: []string{"~/.ssh/id_ed25519", "~/.ssh/lab key"},
+				proxyJump:     "bastion",
+			},
+		},
+		{
+			// Negated pattern excludes the host from the section.
+			alias: "k8s-control-2",
+			want: sshHost{
+				user:          "fallback",
+				port:          "22",
+				identityFiles: []string{"~/.ssh/id_ed25519"},
+			},
+		},
+		{
+			alias: "BASTION",
+			want: sshHost{
+				hostName:      "203.0.113.10",
+				user:          "jump",
+				port:          "22",
+				identityFiles: []string{"~/.ssh/id_ed25519"},
+				proxyJump:     "none",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			if got := c.lookup(tt.alias); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSHConfigApply(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(filename, []byte(testSSHConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := readSSHConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		node Node
+		want Node
+	}{
+		{
+			name: "from ssh config",
+			node: Node{Name: "k8s-control-1"},
+			want: Node{
+				Name:            "k8s-control-1",
+				Addr:            "k8s-control-1.lab.internal:2222",
+				Username:        "admin",
+				PrivateKeyFiles: []string{"~/.ssh/id_ed25519", "~/.ssh/lab key"},
+				ProxyJump:       "bastion",
+			},
+		},
+		{
+			name: "node settings win",
+			node: Node{Name: "k8s-control-1", Addr: "10.10.0.11:22", Username: "root", PrivateKeyFile: "~/.ssh/root"},
+			want: Node{
+				Name:           "k8s-control-1",
+				Addr:           "10.10.0.11:22",
+				Username:       "root",
+				PrivateKeyFile: "~/.ssh/root",
+				ProxyJump:      "bastion",
+			},
+		},
+		{
+			name: "proxy jump none",
+			node: Node{Name: "bastion"},
+			want: Node{
+				Name:            "bastion",
+				Addr:            "203.0.113.10:22",
+				Username:        "jump",
+				PrivateKeyFiles: []string{"~/.ssh/id_ed25519"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := tt.node
+			c.apply(&node)
+			if !reflect.DeepEqual(node, tt.want) {
+				t.Errorf("got %+v, want %+v", node, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveSSHRequiresAddrAndUsername(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(filename, []byte("Host k8s-*\n    HostName %h.lab.internal\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &Config{SSHConfig: filename}
+	cfg.Kubernetes.Nodes = []Node{
+		{Name: "k8s-control-1", Username: "admin"},
+		{Name: "k8s-worker-1"},
+	}
+
+	err := cfg.resolveSSH()
+	if err == nil || !strings.Contains(err.Error(), "k8s-worker-1") {
+		t.Fatalf("expected error naming k8s-worker-1, got %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+// Package kube creates Kubernetes API clients from kubeconfig.
+package kube
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// NewClient returns a client for the cluster using kubeconfig and context
+// from the configuration, which default to the same ones kubectl uses.
+func NewClient(cfg config.Kubernetes) (*kubernetes.Clientset, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if cfg.Kubeconfig != "" {
+		rules.ExplicitPath = cfg.Kubeconfig
+	}
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: cfg.Context}
+
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes client: %w", err)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,235 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// roleLabelPrefix is the prefix of labels that set node roles, e.g.
+// node-role.kubernetes.io/control-plane.
+const roleLabelPrefix = "node-role.kubernetes.io/"
+
+type Node struct {
+	Name    string   `json:"name"`
+	Ready   bool     `json:"ready"`
+	Roles   []string `json:"roles"`
+	Version string   `json:"version"`
+}
+
+type Component struct {
+	Name  string `json:"name"`
+	Node  string `json:"node"`
+	Ready bool   `json:"ready"`
+}
+
+type Pod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	Restarts  int32  `json:"restarts"`
+	Node      string `json:"node,omitempty"`
+}
+
+type PVC struct {
+	Namespace    string `json:"namespace"`
+	Name         string `json:"name"`
+	StorageClass string `json:"storage_class,omitempty"`
+}
+
+// Nodes returns all nodes sorted by name.
+func Nodes(ctx context.Context, client kubernetes.Interface) ([]Node, error) {
+	list, err := client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list nodes: %w", err)
+	}
+
+	var nodes []Node
+	for _, n := range list.Items {
+		node := Node{
+			Name:    n.Name,
+			Version: n.Status.NodeInfo.KubeletVersion,
+		}
+		for _, c := range n.Status.Conditions {
+			if c.Type == corev1.NodeReady {
+				node.Ready = c.Status == corev1.ConditionTrue
+			}
+		}
+		for label := range n.Labels {
+			if role, ok := strings.CutPrefix(label, roleLabelPrefix); ok && role != "" {
+				node.Roles = append(node.Roles, role)
+			}
+		}
+		slices.Sort(node.Roles)
+		nodes = append(nodes, node)
+	}
+
+	slices.SortFunc(nodes, func(a, b Node) int { return strings.Compare(a.Name, b.Name) })
+
+	return nodes, nil
+}
+
+// ControlPlane returns control plane components, which kubeadm runs as
+// static pods labelled with tier=control-plane, sorted by name and node.
+func ControlPlane(ctx context.Context, client kubernetes.Interface) ([]Component, error) {
+	list, err := client.CoreV1().Pods(metav1.NamespaceSystem).List(ctx, metav1.ListOptions{
+		LabelSelector: "tier=control-plane",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list control plane pods: %w", err)
+	}
+
+	var components []Component
+	for _, p := range list.Items {
+		name := p.Labels["component"]
+		if name == "" {
+			name = p.Name
+		}
+		components = append(components, Component{
+			Name:  name,
+			Node:  p.Spec.NodeName,
+			Ready: podReady(p),
+		})
+	}
+
+	slices.SortFunc(components, func(a, b Component) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Node, b.Node)
+	})
+
+	return components, nil
+}
+
+// UnhealthyPods returns pods in all namespaces that are neither running
+// nor completed, sorted by namespace and name.
+func UnhealthyPods(ctx context.Context, client kubernetes.Interface) ([]Pod, error) {
+	list, err := client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+
+	var pods []Pod
+	for _, p := range list.Items {
+		status := podStatus(p)
+		if status == "Running" || status == "Completed" {
+			continue
+		}
+
+		pod := Pod{
+			Namespace: p.Namespace,
+			Name:      p.Name,
+			Status:    status,
+			Node:      p.Spec.NodeName,
+		}
+		for _, c := range p.Status.ContainerStatuses {
+			pod.Restarts += c.RestartCount
+		}
+		pods = append(pods, pod)
+	}
+
+	slices.SortFunc(pods, func(a, b Pod) int {
+		if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return pods, nil
+}
+
+// PendingPVCs returns persistent volume claims in all namespaces that are
+// not bound yet, sorted by namespace and name.
+func PendingPVCs(ctx context.Context, client kubernetes.Interface) ([]PVC, error) {
+	list, err := client.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list persistent volume claims: %w", err)
+	}
+
+	var pvcs []PVC
+	for _, p := range list.Items {
+		if p.Status.Phase != corev1.ClaimPending {
+			continue
+		}
+
+		pvc := PVC{Namespace: p.Namespace, Name: p.Name}
+		if p.Spec.StorageClassName != nil {
+			pvc.StorageClass = *p.Spec.StorageClassName
+		}
+		pvcs = append(pvcs, pvc)
+	}
+
+	slices.SortFunc(pvcs, func(a, b PVC) int {
+		if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return pvcs, nil
+}
+
+// podStatus returns status of the pod the way kubectl shows it, e.g. a
+// running pod whose container keeps crashing is "CrashLoopBackOff".
+func podStatus(p corev1.Pod) string {
+	if p.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+
+	status := string(p.Status.Phase)
+	if p.Status.Reason != "" {
+		status = p.Status.Reason
+	}
+
+	for _, c := range p.Status.InitContainerStatuses {
+		switch {
+		case c.State.Terminated != nil && c.State.Terminated.ExitCode != 0:
+			return "Init:" + terminatedReason(c.State.Terminated)
+		case c.State.Waiting != nil && c.State.Waiting.Reason != "" && c.State.Waiting.Reason != "PodInitializing":
+			return "Init:" + c.State.Waiting.Reason
+		}
+	}
+
+	for _, c := range p.Status.ContainerStatuses {
+		switch {
+		case c.State.Waiting != nil && c.State.Waiting.Reason != "":
+			return c.State.Waiting.Reason
+		case c.State.Terminated != nil && p.Status.Phase != corev1.PodSucceeded:
+			return terminatedReason(c.State.Terminated)
+		}
+	}
+
+	if p.Status.Phase == corev1.PodSucceeded {
+		return "Completed"
+	}
+
+	return status
+}
+
+// terminatedReason returns the reason the container terminated, or its
+// signal or exit code if the runtime doesn't give one.
+func terminatedReason(t *corev1.ContainerStateTerminated) string {
+	switch {
+	case t.Reason != "":
+		return t.Reason
+	case t.Signal != 0:
+		return fmt.Sprintf("Signal:%d", t.Signal)
+	default:
+		return fmt.Sprintf("ExitCode:%d", t.ExitCode)
+	}
+}
+
+func podReady(p corev1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodStatus(t *testing.T) {
+	waiting := func(reason string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: reason},
+		}}
+	}
+	terminated := func(reason string, exitCode, signal int32) corev1.ContainerStatus {
+		return corev1.ContainerStatus{State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{Reason: reason, ExitCode: exitCode, Signal: signal},
+		}}
+	}
+	running := corev1.ContainerStatus{State: corev1.ContainerState{
+		Running: &corev1.ContainerStateRunning{},
+	}}
+
+	tests := []struct {
+		name string
+		pod  corev1.Pod
+		want string
+	}{
+		{
+			name: "running",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{running},
+			}},
+			want: "Running",
+		},
+		{
+			name: "terminating",
+			pod: corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{DeletionTimestamp: &metav1.Time{}},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+			},
+			want: "Terminating",
+		},
+		{
+			name: "evicted",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:  corev1.PodFailed,
+				Reason: "Evicted",
+			}},
+			want: "Evicted",
+		},
+		{
+			name: "crash loop",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{running, waiting("CrashLoopBackOff")},
+			}},
+			want: "CrashLoopBackOff",
+		},
+		{
+			name: "image pull",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:             corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{waiting("ImagePullBackOff")},
+			}},
+			want: "ImagePullBackOff",
+		},
+		{
+			name: "oom killed",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{terminated("OOMKilled", 137, 0)},
+			}},
+			want: "OOMKilled",
+		},
+		{
+			name: "terminated without reason",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:             corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{terminated("", 2, 0)},
+			}},
+			want: "ExitCode:2",
+		},
+		{
+			name: "killed by signal",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:             corev1.PodFailed,
+				ContainerStatuses: []corev1.ContainerStatus{terminated("", 0, 9)},
+			}},
+			want: "Signal:9",
+		},
+		{
+			name: "completed",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:             corev1.PodSucceeded,
+				ContainerStatuses: []corev1.ContainerStatus{terminated("Completed", 0, 0)},
+			}},
+			want: "Completed",
+		},
+		{
+			name: "init container failed",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:                 corev1.PodPending,
+				InitContainerStatuses: []corev1.ContainerStatus{terminated("Error", 1, 0)},
+				ContainerStatuses:     []corev1.ContainerStatus{waiting("PodInitializing")},
+			}},
+			want: "Init:Error",
+		},
+		{
+			name: "init container failed without reason",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:                 corev1.PodPending,
+				InitContainerStatuses: []corev1.ContainerStatus{terminated("", 1, 0)},
+			}},
+			want: "Init:ExitCode:1",
+		},
+		{
+			name: "init container crash loop",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:                 corev1.PodPending,
+				InitContainerStatuses: []corev1.ContainerStatus{terminated("Completed", 0, 0), waiting("CrashLoopBackOff")},
+			}},
+			want: "Init:CrashLoopBackOff",
+		},
+		{
+			name: "initializing",
+			pod: corev1.Pod{Status: corev1.PodStatus{
+				Phase:                 corev1.PodPending,
+				InitContainerStatuses: []corev1.ContainerStatus{waiting("PodInitializing")},
+			}},
+			want: "Pending",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := podStatus(tt.pod); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnhealthyPods(t *testing.T) {
+	pod := func(namespace, name string, phase corev1.PodPhase, restarts int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       corev1.PodSpec{NodeName: "k8s-worker-1"},
+			Status: corev1.PodStatus{
+				Phase:             phase,
+				ContainerStatuses: []corev1.ContainerStatus{{RestartCount: restarts}},
+			},
+		}
+	}
+
+	client := fake.NewClientset(
+		pod("monitoring", "grafana", corev1.PodPending, 0),
+		pod("default", "web", corev1.PodRunning, 3),
+		pod("default", "migrate", corev1.PodSucceeded, 0),
+		pod("default", "backup", corev1.PodFailed, 1),
+	)
+
+	pods, err := UnhealthyPods(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Pod{
+		{Namespace: "default", Name: "backup", Status: "Failed", Restarts: 1, Node: "k8s-worker-1"},
+		{Namespace: "monitoring", Name: "grafana", Status: "Pending", Node: "k8s-worker-1"},
+	}
+	if !reflect.DeepEqual(pods, want) {
+		t.Errorf("got %+v, want %+v", pods, want)
+	}
+}
@@ -0,0 +1,97 @@
+package live
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	reset       = "\033[0m"
+	brightBlack = "\033[90m"
+)
+
+// Lines keeps a block of status lines up to date. On a terminal the
+// lines are redrawn in place, otherwise only lines that have changed are
+// printed, so that output remains readable when redirected to a file.
+//
+// Lines are indented under the step header printed before them.
+type Lines struct {
+	mu       sync.Mutex
+	w        io.Writer
+	tty      bool
+	lines    []string
+	printed  []string
+	rendered bool
+}
+
+func New(w *os.File, n int) *Lines {
+	tty := false
+	if info, err := w.Stat(); err == nil {
+		tty = info.Mode()&os.ModeCharDevice != 0
+	}
+
+	return &Lines{
+		w:       w,
+		tty:     tty,
+		lines:   make([]string, n),
+		printed: make([]string, n),
+	}
+}
+
+// Set updates the text of the i-th line. Changes are not visible until
+// the lines are redrawn with Render.
+func (l *Lines) Set(i int, line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lines[i] = line
+}
+
+func (l *Lines) Render() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.tty {
+		for i, line := range l.lines {
+			if line != l.printed[i] {
+				fmt.Fprintln(l.w, brightBlack+" ↳ "+line+reset)
+				l.printed[i] = line
+			}
+		}
+		return
+	}
+
+	// Move cursor back to the first line before redrawing.
+	if l.rendered {
+		fmt.Fprintf(l.w, "\033[%dA", len(l.lines))
+	}
+
+	for i, line := range l.lines {
+		fmt.Fprint(l.w, "\033[2K"+brightBlack+" ↳ "+line+reset+"\n")
+		l.printed[i] = line
+	}
+
+	l.rendered = true
+}
+
+// Line is a single status line that is redrawn whenever it is updated.
+// It is useful for showing output of long running commands as it arrives.
+type Line struct {
+	lines *Lines
+}
+
+func NewLine(w *os.File) *Line {
+	return &Line{lines: New(w, 1)}
+}
+
+// Update sets and redraws the line. Empty lines are ignored, so that the
+// last meaningful status stays visible.
+func (l *Line) Update(line string) {
+	if line == "" {
+		return
+	}
+	l.lines.Set(0, line)
+	l.lines.Render()
+}
@@ -0,0 +1,99 @@
+package power
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// ipmi controls nodes using ipmitool over the IPMI v2.0 LAN interface.
+type ipmi struct {
+	host     string
+	port     string
+	username string
+	password string
+}
+
+func newIPMI(bmc config.BMC) (*ipmi, error) {
+	if _, err := exec.LookPath("ipmitool"); err != nil {
+		return nil, fmt.Errorf("ipmi driver requires ipmitool: %w", err)
+	}
+
+	host, port, err := net.SplitHostPort(bmc.Addr)
+	if err != nil {
+		host, port = bmc.Addr, "623"
+	}
+
+	return &ipmi{
+		host:     host,
+		port:     port,
+		username: bmc.Username,
+		password: bmc.Password,
+	}, nil
+}
+
+func (i *ipmi) Name() string {
+	return "ipmi"
+}
+
+func (i *ipmi) On(ctx context.Context) error {
+	_, err := i.chassisPower(ctx, "on")
+	return err
+}
+
+func (i *ipmi) Off(ctx context.Context, force bool) error {
+	action := "soft"
+	if force {
+		action = "off"
+	}
+	_, err := i.chassisPower(ctx, action)
+	return err
+}
+
+func (i *ipmi) Cycle(ctx context.Context) error {
+	_, err := i.chassisPower(ctx, "cycle")
+	return err
+}
+
+func (i *ipmi) Status(ctx context.Context) (State, error) {
+	out, err := i.chassisPower(ctx, "status")
+	if err != nil {
+		return StateUnknown, err
+	}
+
+	// Output looks like "Chassis Power is on".
+	switch {
+	case strings.HasSuffix(out, " on"):
+		return StateOn, nil
+	case strings.HasSuffix(out, " off"):
+		return StateOff, nil
+	default:
+		return StateUnknown, nil
+	}
+}
+
+func (i *ipmi) chassisPower(ctx context.Context, action string) (string, error) {
+	// Password is passed through the environment so that it doesn't show
+	// up in the process list.
+	cmd := exec.CommandContext(ctx, "ipmitool", "-I", "lanplus", "-H", i.host, "-p", i.port, "-U", i.username, "-E", "chassis", "power", action)
+	cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+i.password)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("ipmitool: %s", msg)
+		}
+		return "", fmt.Errorf("ipmitool: %w", err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
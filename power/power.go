@@ -0,0 +1,64 @@
+// Package power controls power state of nodes using Wake-on-LAN or their
+// baseboard management controllers (BMC).
+package power
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// ErrNotSupported is returned when the driver can't perform the action,
+// e.g. Wake-on-LAN can't power nodes off.
+var ErrNotSupported = errors.New("not supported by driver")
+
+type State string
+
+const (
+	StateOn      State = "on"
+	StateOff     State = "off"
+	StateUnknown State = "unknown"
+)
+
+// Driver controls the power of a single node.
+type Driver interface {
+	// Name returns the name of the driver, e.g. "redfish".
+	Name() string
+
+	// On powers the node on.
+	On(ctx context.Context) error
+
+	// Off powers the node off. Operating system is asked to shut down
+	// gracefully unless force is set, in which case power is cut.
+	Off(ctx context.Context, force bool) error
+
+	// Cycle hard resets the node.
+	Cycle(ctx context.Context) error
+
+	// Status returns the current power state of the node.
+	Status(ctx context.Context) (State, error)
+}
+
+// New returns the driver configured for the node. Nodes without a BMC
+// fall back to Wake-on-LAN if they have a MAC address.
+func New(cfg *config.Config, node config.Node) (Driver, error) {
+	if node.BMC == nil {
+		if node.MAC == "" {
+			return nil, fmt.Errorf("neither bmc nor mac address is configured for %s", node.Name)
+		}
+		return &wol{cfg: cfg, node: node}, nil
+	}
+
+	switch node.BMC.Driver {
+	case "wol":
+		return &wol{cfg: cfg, node: node}, nil
+	case "ipmi":
+		return newIPMI(*node.BMC)
+	case "redfish":
+		return newRedfish(*node.BMC)
+	default:
+		return nil, fmt.Errorf("unsupported bmc driver %q", node.BMC.Driver)
+	}
+}
@@ -0,0 +1,160 @@
+package power
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// redfish controls nodes using the DMTF Redfish REST API.
+type redfish struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	password string
+}
+
+func newRedfish(bmc config.BMC) (*redfish, error) {
+	baseURL := bmc.Addr
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+
+	return &redfish{
+		client: &http.Client{
+			Transport: &http.Transport{
+				// BMCs usually ship with self-signed certificates.
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: bmc.Insecure},
+			},
+			Timeout: 30 * time.Second,
+		},
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: bmc.Username,
+		password: bmc.Password,
+	}, nil
+}
+
+func (r *redfish) Name() string {
+	return "redfish"
+}
+
+func (r *redfish) On(ctx context.Context) error {
+	return r.reset(ctx, "On")
+}
+
+func (r *redfish) Off(ctx context.Context, force bool) error {
+	if force {
+		return r.reset(ctx, "ForceOff")
+	}
+	return r.reset(ctx, "GracefulShutdown")
+}
+
+func (r *redfish) Cycle(ctx context.Context) error {
+	return r.reset(ctx, "ForceRestart")
+}
+
+func (r *redfish) Status(ctx context.Context) (State, error) {
+	system, err := r.system(ctx)
+	if err != nil {
+		return StateUnknown, err
+	}
+
+	var resp struct {
+		PowerState string `json:"PowerState"`
+	}
+	if err := r.do(ctx, http.MethodGet, system, nil, &resp); err != nil {
+		return StateUnknown, fmt.Errorf("get system: %w", err)
+	}
+
+	switch resp.PowerState {
+	case "On", "PoweringOn":
+		return StateOn, nil
+	case "Off", "PoweringOff":
+		return StateOff, nil
+	default:
+		return StateUnknown, nil
+	}
+}
+
+func (r *redfish) reset(ctx context.Context, resetType string) error {
+	system, err := r.system(ctx)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]string{"ResetType": resetType}
+	if err := r.do(ctx, http.MethodPost, system+"/Actions/ComputerSystem.Reset", body, nil); err != nil {
+		return fmt.Errorf("reset %s: %w", resetType, err)
+	}
+
+	return nil
+}
+
+// system returns the path of the first computer system managed by the BMC.
+// Servers in a homelab only ever have one.
+func (r *redfish) system(ctx context.Context) (string, error) {
+	var resp struct {
+		Members []struct {
+			ID string `json:"@odata.id"`
+		} `json:"Members"`
+	}
+	if err := r.do(ctx, http.MethodGet, "/redfish/v1/Systems", nil, &resp); err != nil {
+		return "", fmt.Errorf("list systems: %w", err)
+	}
+
+	if len(resp.Members) == 0 {
+		return "", fmt.Errorf("no systems found")
+	}
+
+	return resp.Members[0].ID, nil
+}
+
+func (r *redfish) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("json: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(r.username, r.password)
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+
+	return nil
+}
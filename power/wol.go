@@ -0,0 +1,46 @@
+package power
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/wakeonlan"
+)
+
+// wol can only power nodes on. Power state is guessed by checking whether
+// the node accepts connections.
+type wol struct {
+	cfg  *config.Config
+	node config.Node
+}
+
+func (w *wol) Name() string {
+	return "wol"
+}
+
+func (w *wol) On(ctx context.Context) error {
+	return wakeonlan.Wake(w.cfg, w.node)
+}
+
+func (w *wol) Off(ctx context.Context, force bool) error {
+	return ErrNotSupported
+}
+
+func (w *wol) Cycle(ctx context.Context) error {
+	return ErrNotSupported
+}
+
+func (w *wol) Status(ctx context.Context) (State, error) {
+	dialer := &net.Dialer{Timeout: time.Second}
+
+	conn, err := dialer.DialContext(ctx, "tcp", w.node.Addr)
+	if err != nil {
+		// Node might be up with the service stopped, so we can't be sure.
+		return StateUnknown, nil
+	}
+	conn.Close()
+
+	return StateOn, nil
+}
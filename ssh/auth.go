@@ -0,0 +1,389 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+const (
+	AuthAgent               = "agent"
+	AuthPublicKey           = "publickey"
+	AuthPassword            = "password"
+	AuthKeyboardInteractive = "keyboard-interactive"
+)
+
+// defaultAuthOrder is used when the node doesn't configure auth methods.
+var defaultAuthOrder = []string{AuthAgent, AuthPublicKey, AuthPassword, AuthKeyboardInteractive}
+
+// Secrets entered by the operator are cached for the lifetime of the
+// process, so that commands connecting to many nodes, or reconnecting to
+// the same node, only prompt once. Mutex is held while prompting, so that
+// concurrent connections don't ask for the same secret twice.
+var (
+	secretsMu sync.Mutex
+	signers   = map[string]ssh.Signer{}
+	passwords = map[string]string{}
+)
+
+// authMethods returns auth methods for the node in the configured order.
+// Returned closer must be called once the connection is established, to
+// release the connection to ssh-agent.
+func authMethods(node config.Node) ([]ssh.AuthMethod, func(), error) {
+	order := node.AuthMethods
+	if len(order) == 0 {
+		order = defaultAuthOrder
+	}
+
+	for _, name := range order {
+		switch name {
+		case AuthAgent, AuthPublicKey, AuthPassword, AuthKeyboardInteractive:
+		default:
+			return nil, nil, fmt.Errorf("unsupported auth method %q", name)
+		}
+	}
+
+	var agentClient agent.ExtendedAgent
+	closer := func() {}
+	if slices.Contains(order, AuthAgent) {
+		// Stale socket should not prevent other methods from working.
+		if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+			if conn, err := net.Dial("unix", socket); err == nil {
+				agentClient = agent.NewClient(conn)
+				closer = func() { conn.Close() }
+			}
+		}
+	}
+
+	keys := privateKeyFiles(node)
+	publicKeys := false
+
+	var methods []ssh.AuthMethod
+	for _, name := range order {
+		switch name {
+		case AuthAgent, AuthPublicKey:
+			// Each method is only tried once, so keys from the agent and
+			// from files are offered by a single method, in the configured
+			// order.
+			if publicKeys || (agentClient == nil && len(keys) == 0) {
+				continue
+			}
+			publicKeys = true
+
+			methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+				return publicKeySigners(order, agentClient, keys), nil
+			}))
+
+		case AuthPassword:
+			// Only prompt for a password when it's explicitly asked for,
+			// otherwise nodes with keys would prompt needlessly.
+			if node.Password == "" && len(node.AuthMethods) == 0 {
+				continue
+			}
+
+			methods = append(methods, ssh.PasswordCallback(func() (string, error) {
+				return password(node)
+			}))
+
+		case AuthKeyboardInteractive:
+			if node.Password == "" && len(node.AuthMethods) == 0 {
+				continue
+			}
+
+			methods = append(methods, ssh.KeyboardInteractive(keyboardInteractive(node)))
+		}
+	}
+
+	if len(methods) == 0 {
+		closer()
+		return nil, nil, fmt.Errorf("no auth methods available for %s", node.Name)
+	}
+
+	return methods, closer, nil
+}
+
+// publicKeySigners returns keys from the agent and key files in the
+// configured order. Keys that can't be loaded are skipped, so that a
+// broken key doesn't prevent the others from being tried.
+func publicKeySigners(order []string, agentClient agent.ExtendedAgent, keys []string) []ssh.Signer {
+	var signers []ssh.Signer
+	for _, name := range order {
+		switch name {
+		case AuthAgent:
+			if agentClient == nil {
+				continue
+			}
+			agentSigners, err := agentClient.Signers()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "⚠️  Skipping ssh-agent: %s\n", err)
+				continue
+			}
+			signers = append(signers, agentSigners...)
+
+		case AuthPublicKey:
+			for _, key := range keys {
+				signer, err := keyFileSigner(key)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "⚠️  Skipping private key %s: %s\n", key, err)
+					continue
+				}
+				signers = append(signers, signer)
+			}
+		}
+	}
+	return signers
+}
+
+// privateKeyFiles returns paths of all private keys configured for the
+// node. Certificates can be given instead of keys, in which case the key
+// is expected to be next to it, following OpenSSH naming conventions.
+func privateKeyFiles(node config.Node) []string {
+	var files []string
+	if node.PrivateKeyFile != "" {
+		files = append(files, node.PrivateKeyFile)
+	}
+	files = append(files, node.PrivateKeyFiles...)
+
+	seen := make(map[string]struct{}, len(files))
+
+	var keys []string
+	for _, f := range files {
+		key := strings.TrimSuffix(f, "-cert.pub")
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// keyFileSigner returns a signer for the private key file. If its public
+// key can be read without decrypting it, the key is only decrypted once the
+// server accepts the public key, so that encrypted keys that aren't used
+// don't prompt for a passphrase.
+func keyFileSigner(filename string) (ssh.Signer, error) {
+	path, err := config.ExpandTilde(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificate is offered instead of the key if there is one.
+	for _, pubFile := range []string{path + "-cert.pub", path + ".pub"} {
+		b, err := os.ReadFile(pubFile)
+		if err != nil {
+			continue
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", pubFile, err)
+		}
+		return &lazySigner{filename: filename, pub: pub}, nil
+	}
+
+	// OpenSSH format stores the public key unencrypted.
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if _, err := ssh.ParsePrivateKey(pem); errors.As(err, &missing) && missing.PublicKey != nil {
+		return &lazySigner{filename: filename, pub: missing.PublicKey}, nil
+	}
+
+	return loadSigner(filename)
+}
+
+// lazySigner loads the private key when it is first used to sign.
+type lazySigner struct {
+	filename string
+	pub      ssh.PublicKey
+}
+
+func (s *lazySigner) PublicKey() ssh.PublicKey {
+	return s.pub
+}
+
+func (s *lazySigner) Sign(rand io.Reader, data []byte) (*ssh.Signature, error) {
+	return s.SignWithAlgorithm(rand, data, "")
+}
+
+func (s *lazySigner) SignWithAlgorithm(rand io.Reader, data []byte, algorithm string) (*ssh.Signature, error) {
+	signer, err := loadSigner(s.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if algorithm == "" {
+		return signer.Sign(rand, data)
+	}
+
+	as, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return nil, fmt.Errorf("%s can't sign with %s", s.filename, algorithm)
+	}
+
+	return as.SignWithAlgorithm(rand, data, algorithm)
+}
+
+// loadSigner reads the private key, prompting for a passphrase if it is
+// encrypted, and pairs it with its certificate if one exists.
+func loadSigner(filename string) (ssh.Signer, error) {
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	if signer, ok := signers[filename]; ok {
+		return signer, nil
+	}
+
+	path, err := config.ExpandTilde(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read private key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(pem)
+
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, perr := promptSecret(fmt.Sprintf("🔑 Enter passphrase for %s: ", filename))
+		if perr != nil {
+			return nil, perr
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key: %w", err)
+	}
+
+	// OpenSSH looks for certificates next to the private key.
+	certFile := path + "-cert.pub"
+	if b, err := os.ReadFile(certFile); err == nil {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate: %w", err)
+		}
+
+		cert, ok := pub.(*ssh.Certificate)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a certificate", certFile)
+		}
+
+		signer, err = ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			return nil, fmt.Errorf("certificate signer: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read certificate: %w", err)
+	}
+
+	signers[filename] = signer
+
+	return signer, nil
+}
+
+// password returns the configured password or prompts for one.
+func password(node config.Node) (string, error) {
+	if node.Password != "" {
+		return node.Password, nil
+	}
+
+	key := node.Username + "@" + node.Addr
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	if p, ok := passwords[key]; ok {
+		return p, nil
+	}
+
+	p, err := promptSecret(fmt.Sprintf("🔑 Password for %s: ", key))
+	if err != nil {
+		return "", err
+	}
+
+	passwords[key] = p
+
+	return p, nil
+}
+
+// keyboardInteractive answers password prompts with the configured
+// password, and asks the operator to answer anything else, e.g. OTP codes.
+func keyboardInteractive(node config.Node) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		if instruction != "" {
+			fmt.Fprintln(os.Stderr, instruction)
+		}
+
+		answers := make([]string, len(questions))
+		for i, q := range questions {
+			if !echos[i] && strings.Contains(strings.ToLower(q), "password") {
+				p, err := password(node)
+				if err != nil {
+					return nil, err
+				}
+				answers[i] = p
+				continue
+			}
+
+			var err error
+			secretsMu.Lock()
+			if echos[i] {
+				answers[i], err = promptLine(q)
+			} else {
+				answers[i], err = promptSecret(q)
+			}
+			secretsMu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return answers, nil
+	}
+}
+
+// promptSecret reads a line from the terminal without echoing it.
+func promptSecret(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("can't prompt for secret: stdin is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read input: %w", err)
+	}
+
+	return string(b), nil
+}
+
+func promptLine(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	var line string
+	if _, err := fmt.Fscanln(os.Stdin, &line); err != nil {
+		return "", fmt.Errorf("read input: %w", err)
+	}
+
+	return line, nil
+}
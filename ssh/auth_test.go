@@ -0,0 +1,155 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestPublicKeyAuth(t *testing.T) {
+	dir := t.TempDir()
+
+	good := writeKey(t, filepath.Join(dir, "good"), "")
+	encrypted := writeKey(t, filepath.Join(dir, "encrypted"), "secret")
+	broken := filepath.Join(dir, "broken")
+	if err := os.WriteFile(broken, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, agentKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentPub, err := ssh.NewPublicKey(agentKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Encrypted keys can't prompt for a passphrase in tests, so offering
+	// one to a server that accepts it fails the connection.
+	tests := []struct {
+		name       string
+		order      []string
+		keys       []string
+		authorized []ssh.PublicKey
+		agent      bool
+	}{
+		{
+			name:       "broken and missing keys are skipped",
+			order:      []string{AuthAgent, AuthPublicKey},
+			keys:       []string{filepath.Join(dir, "missing"), broken, filepath.Join(dir, "good")},
+			authorized: []ssh.PublicKey{good},
+		},
+		{
+			name:       "encrypted key isn't decrypted unless accepted",
+			order:      []string{AuthPublicKey},
+			keys:       []string{filepath.Join(dir, "encrypted"), filepath.Join(dir, "good")},
+			authorized: []ssh.PublicKey{good},
+		},
+		{
+			name:       "agent is tried before keys",
+			order:      []string{AuthAgent, AuthPublicKey},
+			keys:       []string{filepath.Join(dir, "encrypted")},
+			authorized: []ssh.PublicKey{agentPub, encrypted},
+			agent:      true,
+		},
+		{
+			name:       "keys are tried after agent fails",
+			order:      []string{AuthAgent, AuthPublicKey},
+			keys:       []string{filepath.Join(dir, "good")},
+			authorized: []ssh.PublicKey{good},
+			agent:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SSH_AUTH_SOCK", "")
+			if tt.agent {
+				t.Setenv("SSH_AUTH_SOCK", serveAgent(t, agentKey))
+			}
+
+			srv := newTestServer(t)
+			srv.authorized = tt.authorized
+
+			node := srv.node
+			node.Password = ""
+			node.AuthMethods = tt.order
+			node.PrivateKeyFiles = tt.keys
+
+			c, err := New(node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+		})
+	}
+}
+
+// writeKey writes a new OpenSSH private key, encrypted if passphrase is
+// set, and returns its public key.
+func writeKey(t *testing.T, filename, passphrase string) ssh.PublicKey {
+	t.Helper()
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(key, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filename, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sshPub
+}
+
+// serveAgent serves an ssh-agent holding the key, and returns its socket.
+func serveAgent(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	return socket
+}
@@ -1,124 +1,82 @@
 package ssh
 
 import (
-	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/wait"
 )
 
-const DaemonStatusStopped = 0
+const (
+	DaemonStatusStopped = 0
+	DaemonStatusRunning = 1
+)
 
 var (
 	ErrAlreadyInMaintenance = errors.New("already in maintenance")
 	ErrNotInMaintenance     = errors.New("not in maintenance")
 )
 
+// Client runs commands on a node. It is safe for concurrent use and
+// reconnects if the connection breaks between commands.
 type Client struct {
-	node config.Node
-	ssh  *ssh.Client
-	buf  *bytes.Buffer
+	node      config.Node
+	keepAlive time.Duration
+	pooled    bool
+
+	mu    sync.Mutex
+	ssh   *ssh.Client
+	jumps []*ssh.Client
+	done  chan struct{}
 }
 
+// New connects to the node. Connection is not shared, so it must be
+// closed by the caller. See Get for shared connections.
 func New(node config.Node) (*Client, error) {
-	privateKeyFile, err := expandTilde(node.PrivateKeyFile)
-	if err != nil {
+	c := &Client{node: node, keepAlive: DefaultKeepAlive}
+	if _, err := c.conn(); err != nil {
 		return nil, err
 	}
-
-	pem, err := os.ReadFile(privateKeyFile)
-	if err != nil {
-		return nil, fmt.Errorf("read private key: %w", err)
-	}
-
-	key, err := ssh.ParsePrivateKey(pem)
-	if err != nil {
-		return nil, fmt.Errorf("parse private key: %w", err)
-	}
-
-	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(node.HostKey))
-	if err != nil {
-		return nil, fmt.Errorf("parse host key: %w", err)
-	}
-
-	config := &ssh.ClientConfig{
-		User: node.Username,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(key),
-		},
-		HostKeyCallback: ssh.FixedHostKey(hostKey),
-	}
-
-	client, err := ssh.Dial("tcp", node.Addr, config)
-	if err != nil {
-		return nil, err
-	}
-
-	return &Client{node, client, &bytes.Buffer{}}, nil
+	return c, nil
 }
 
-func (c *Client) SnapshotETCD(filename string) error {
-	// Only root can read certs for connecting to the etcd cluster.
-	cmd := "sudo etcdctl --cacert=/etc/kubernetes/pki/etcd/ca.crt --cert=/etc/kubernetes/pki/etcd/server.crt --key=/etc/kubernetes/pki/etcd/server.key snapshot save " + filename
-	if _, err := c.run(cmd); err != nil {
-		return fmt.Errorf("save: %w", err)
-	}
-
-	// Update file permissions to allow scp'ing the snapshot back to local machine.
-	cmd = fmt.Sprintf("sudo chown %s:%s %s", c.node.Username, c.node.Username, filename)
-	if _, err := c.run(cmd); err != nil {
-		return fmt.Errorf("chown: %w", err)
-	}
-
-	return nil
-}
-
-func (c *Client) Compress(filename string) error {
-	if _, err := c.run("zstd --rm " + filename); err != nil {
+// Compress compresses the file with zstd, replacing it with filename.zst.
+// Progress reported by zstd is passed to fn as it arrives, fn may be nil.
+func (c *Client) Compress(filename string, fn LineFunc) error {
+	if _, err := c.RunStream(command("zstd", "--rm", "--progress", "--", filename), fn); err != nil {
 		return fmt.Errorf("zstd: %w", err)
 	}
 	return nil
 }
 
-func (c *Client) Copy(src, dst string) error {
-	sftp, err := sftp.NewClient(c.ssh)
-	if err != nil {
-		return fmt.Errorf("sftp client: %w", err)
-	}
-	defer sftp.Close()
-
-	srcFile, err := sftp.Open(src)
+// FileSize returns size of the remote file in bytes.
+func (c *Client) FileSize(filename string) (int64, error) {
+	out, err := c.output(command("stat", "-c", "%s", "--", filename))
 	if err != nil {
-		return fmt.Errorf("sftp open: %w", err)
+		return 0, fmt.Errorf("stat: %w", err)
 	}
-	defer srcFile.Close()
 
-	dstFile, err := os.Create(dst)
+	size, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
 	if err != nil {
-		return fmt.Errorf("open: %w", err)
+		return 0, fmt.Errorf("parse size: %w", err)
 	}
-	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	if err != nil {
-		return fmt.Errorf("copy: %w", err)
-	}
-
-	return nil
+	return size, nil
 }
 
 func (c *Client) SHA512Sum(filename string) (string, error) {
-	out, err := c.run("sha512sum " + filename)
+	out, err := c.output(command("sha512sum", "--", filename))
 	if err != nil {
 		return "", fmt.Errorf("sha512sum: %w", err)
 	}
@@ -128,66 +86,149 @@ func (c *Client) SHA512Sum(filename string) (string, error) {
 	return hash, nil
 }
 
-func (c *Client) Delete(filename string) error {
-	if _, err := c.run("rm " + filename); err != nil {
-		return fmt.Errorf("remove snapshot: %w", err)
+// tempDirPrefix is the prefix of directories created by MakeTempDir.
+const tempDirPrefix = "/tmp/labctl."
+
+// MakeTempDir creates a directory that only the SSH user can access, for
+// files that must not be readable by other users, e.g. etcd snapshots.
+func (c *Client) MakeTempDir() (string, error) {
+	out, err := c.output(command("mktemp", "-d", tempDirPrefix+"XXXXXXXXXX"))
+	if err != nil {
+		return "", fmt.Errorf("mktemp: %w", err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// RemoveTempDir removes a directory created by MakeTempDir and everything
+// in it. Files in it may be owned by root.
+func (c *Client) RemoveTempDir(dir string) error {
+	if !strings.HasPrefix(dir, tempDirPrefix) || strings.Contains(dir, "..") {
+		return fmt.Errorf("%q is not a temporary directory", dir)
+	}
+	if _, err := c.output(sudo("rm", "-rf", "--", dir)); err != nil {
+		return fmt.Errorf("remove temporary directory: %w", err)
 	}
 	return nil
 }
 
 func (c *Client) CephEnterMaintenance(hostname string) error {
-	// Redirect stderr to stdout so we can inspect the output and return
-	// a more specialised error if host is already in maintenance mode.
-	out, err := c.run("sudo ceph orch host maintenance enter " + hostname + " 2>&1")
-	if err != nil {
-		if strings.Contains(out, "already in maintenance") {
+	if err := validateHostname(hostname); err != nil {
+		return err
+	}
+
+	cmd := sudo("ceph", "orch", "host", "maintenance", "enter", hostname)
+
+	if _, err := c.output(cmd); err != nil {
+		if stderrContains(err, "already in maintenance") {
 			return ErrAlreadyInMaintenance
 		}
-		return err
+		return fmt.Errorf("ceph orch host maintenance enter: %w", err)
 	}
 	return nil
 }
 
 func (c *Client) CephExitMaintenance(hostname string) error {
-	// Redirect stderr to stdout so we can inspect the output and return
-	// a more specialised error if host is not in maintenance mode.
-	out, err := c.run("sudo ceph orch host maintenance exit " + hostname + " 2>&1")
-	if err != nil {
-		if strings.Contains(out, "not in maintenance mode") {
+	if err := validateHostname(hostname); err != nil {
+		return err
+	}
+
+	if _, err := c.output(sudo("ceph", "orch", "host", "maintenance", "exit", hostname)); err != nil {
+		if stderrContains(err, "not in maintenance mode") {
 			return ErrNotInMaintenance
 		}
-		return err
+		return fmt.Errorf("ceph orch host maintenance exit: %w", err)
 	}
 	return nil
 }
 
 func (c *Client) CephInMaintenance(hostname string) (bool, error) {
-	out, err := c.run("sudo ceph orch host ls --format json --host_pattern " + hostname)
-	if err != nil {
+	if err := validateHostname(hostname); err != nil {
 		return false, err
 	}
+
+	out, err := c.output(sudo("ceph", "orch", "host", "ls", "--format", "json", "--host_pattern", hostname))
+	if err != nil {
+		return false, fmt.Errorf("ceph orch host ls: %w", err)
+	}
 	return strings.Contains(out, `"status": "maintenance"`), nil
 }
 
 func (c *Client) CephHealth() (string, error) {
-	out, err := c.run("sudo ceph health")
+	out, err := c.output(sudo("ceph", "health"))
 	if err != nil {
 		return "", fmt.Errorf("ceph health: %w", err)
 	}
 	return strings.TrimSpace(out), nil
 }
 
+type CephStatus struct {
+	FSID   string `json:"fsid"`
+	Health struct {
+		Status string `json:"status"`
+	} `json:"health"`
+	PGMap struct {
+		NumPGs     int `json:"num_pgs"`
+		PGsByState []struct {
+			Name  string `json:"state_name"`
+			Count int    `json:"count"`
+		} `json:"pgs_by_state"`
+		MisplacedObjects int     `json:"misplaced_objects"`
+		MisplacedTotal   int     `json:"misplaced_total"`
+		MisplacedRatio   float64 `json:"misplaced_ratio"`
+		DegradedObjects  int     `json:"degraded_objects"`
+		DegradedTotal    int     `json:"degraded_total"`
+		DegradedRatio    float64 `json:"degraded_ratio"`
+		RecoveringBytes  uint64  `json:"recovering_bytes_per_sec"`
+	} `json:"pgmap"`
+}
+
+// ActiveCleanPGs returns the number of placement groups that are active
+// and clean, including ones that are being scrubbed.
+func (s *CephStatus) ActiveCleanPGs() int {
+	count := 0
+	for _, state := range s.PGMap.PGsByState {
+		if activeClean(state.Name) {
+			count += state.Count
+		}
+	}
+	return count
+}
+
+// activeClean reports whether the placement group state, e.g.
+// "active+clean+scrubbing+deep", is both active and clean.
+func activeClean(state string) bool {
+	flags := strings.Split(state, "+")
+	return slices.Contains(flags, "active") && slices.Contains(flags, "clean")
+}
+
+func (c *Client) CephStatus() (*CephStatus, error) {
+	out, err := c.output(sudo("ceph", "status", "-f", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("ceph status: %w", err)
+	}
+
+	var status CephStatus
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return &status, nil
+}
+
 func (c *Client) SetOSDFlag(flag string) error {
-	// For some reason, the output is written to stderr, so
-	// we must redirect stderr to stdout ¯\_(ツ)_/¯
-	out, err := c.run("sudo ceph osd set " + flag + " 2>&1")
+	if err := validate("osd flag", flag, flagRegexp); err != nil {
+		return err
+	}
+
+	res, err := c.Run(sudo("ceph", "osd", "set", flag))
 	if err != nil {
 		return fmt.Errorf("ceph osd set: %w", err)
 	}
 
 	// We could run another command to check the key was set, but
 	// instead we'll check if the command returned expected output.
-	out = strings.TrimSpace(out)
+	// For some reason, the output is written to stderr ¯\_(ツ)_/¯
+	out := strings.TrimSpace(res.Stderr)
 
 	sentinel := flag + " is set"
 	if flag == "pause" {
@@ -204,16 +245,19 @@ func (c *Client) SetOSDFlag(flag string) error {
 }
 
 func (c *Client) UnsetOSDFlag(flag string) error {
-	// For some reason, the output is written to stderr, so
-	// we must redirect stderr to stdout ¯\_(ツ)_/¯
-	out, err := c.run("sudo ceph osd unset " + flag + " 2>&1")
+	if err := validate("osd flag", flag, flagRegexp); err != nil {
+		return err
+	}
+
+	res, err := c.Run(sudo("ceph", "osd", "unset", flag))
 	if err != nil {
 		return fmt.Errorf("ceph osd unset: %w", err)
 	}
 
 	// We could run another command to check the key was unset, but
 	// instead we'll check if the command returned expected output.
-	out = strings.TrimSpace(out)
+	// For some reason, the output is written to stderr ¯\_(ツ)_/¯
+	out := strings.TrimSpace(res.Stderr)
 
 	sentinel := flag + " is unset"
 	if flag == "pause" {
@@ -229,43 +273,41 @@ func (c *Client) UnsetOSDFlag(flag string) error {
 	return nil
 }
 
-func (c *Client) StopCephService(name string) error {
-	if _, err := c.run("sudo ceph orch stop " + name); err != nil {
+// StopProgressFunc is called with the number of stopped daemons every
+// time their status is checked.
+type StopProgressFunc func(stopped, total int)
+
+// StopCephService stops all daemons of the service and waits until they
+// are reported as stopped or the context is done. Progress is passed to
+// fn, which may be nil.
+func (c *Client) StopCephService(ctx context.Context, name string, fn StopProgressFunc) error {
+	if err := validateCephName("service name", name); err != nil {
+		return err
+	}
+
+	if _, err := c.output(sudo("ceph", "orch", "stop", name)); err != nil {
 		return fmt.Errorf("ceph orch stop: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			daemons, err := c.CephStatusByServiceName(name)
-			if err != nil {
-				return fmt.Errorf("daemon status: %w", err)
-			}
-
-			allStopped := true
-			for _, daemon := range daemons {
-				if daemon.Status != DaemonStatusStopped {
-					allStopped = false
-				}
-			}
-
-			if allStopped {
-				return nil
-			}
-		case <-ctx.Done():
-			return fmt.Errorf("ceph orch stop: %w", ctx.Err())
+	err := wait.Poll(ctx, wait.DefaultBackoff, func(ctx context.Context) (bool, error) {
+		daemons, err := c.CephStatusByServiceName(name)
+		if err != nil {
+			return false, fmt.Errorf("daemon status: %w", err)
 		}
+		return allStopped(daemons, fn), nil
+	})
+	if err != nil {
+		return fmt.Errorf("ceph orch stop: %w", err)
 	}
+
+	return nil
 }
 
 func (c *Client) CephStatusByServiceName(name string) ([]CephDaemon, error) {
-	return c.cephOrchPs("--service_name " + name)
+	if err := validateCephName("service name", name); err != nil {
+		return nil, err
+	}
+	return c.cephOrchPs("--service_name", name)
 }
 
 type CephDaemon struct {
@@ -275,8 +317,8 @@ type CephDaemon struct {
 	ID     string `json:"daemon_id"`
 }
 
-func (c *Client) cephOrchPs(filter string) ([]CephDaemon, error) {
-	out, err := c.run("sudo ceph orch ps -f json " + filter)
+func (c *Client) cephOrchPs(filter ...string) ([]CephDaemon, error) {
+	out, err := c.output(sudo("ceph", append([]string{"orch", "ps", "-f", "json"}, filter...)...))
 	if err != nil {
 		return nil, fmt.Errorf("ceph orch ps: %w", err)
 	}
@@ -289,55 +331,71 @@ func (c *Client) cephOrchPs(filter string) ([]CephDaemon, error) {
 	return daemons, nil
 }
 
+func (c *Client) CephStatusByHost(hostname string) ([]CephDaemon, error) {
+	if err := validateHostname(hostname); err != nil {
+		return nil, err
+	}
+	return c.cephOrchPs("--hostname", hostname)
+}
+
 func (c *Client) CephStatusByDaemonType(daemonType string) ([]CephDaemon, error) {
-	return c.cephOrchPs("--daemon_type " + daemonType)
+	if err := validateCephName("daemon type", daemonType); err != nil {
+		return nil, err
+	}
+	return c.cephOrchPs("--daemon_type", daemonType)
 }
 
-func (c *Client) StopCephDaemon(name string) error {
-	if _, err := c.run("sudo ceph orch daemon stop " + name); err != nil {
+// StopCephDaemon stops the daemon and waits until it is reported as
+// stopped or the context is done. Progress is passed to fn, which may be
+// nil.
+func (c *Client) StopCephDaemon(ctx context.Context, name string, fn StopProgressFunc) error {
+	if err := validateCephName("daemon name", name); err != nil {
+		return err
+	}
+
+	if _, err := c.output(sudo("ceph", "orch", "daemon", "stop", name)); err != nil {
 		return fmt.Errorf("ceph orch daemon stop: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			daemons, err := c.CephStatusByDaemonName(name)
-			if err != nil {
-				return fmt.Errorf("daemon status: %w", err)
-			}
-
-			allStopped := true
-			for _, daemon := range daemons {
-				if daemon.Status != DaemonStatusStopped {
-					allStopped = false
-				}
-			}
-
-			if allStopped {
-				return nil
-			}
-		case <-ctx.Done():
-			return fmt.Errorf("ceph orch daemon stop: %w", ctx.Err())
+	err := wait.Poll(ctx, wait.DefaultBackoff, func(ctx context.Context) (bool, error) {
+		daemons, err := c.CephStatusByDaemonName(name)
+		if err != nil {
+			return false, fmt.Errorf("daemon status: %w", err)
+		}
+		return allStopped(daemons, fn), nil
+	})
+	if err != nil {
+		return fmt.Errorf("ceph orch daemon stop: %w", err)
+	}
+
+	return nil
+}
+
+func allStopped(daemons []CephDaemon, fn StopProgressFunc) bool {
+	stopped := 0
+	for _, daemon := range daemons {
+		if daemon.Status == DaemonStatusStopped {
+			stopped++
 		}
 	}
+
+	if fn != nil {
+		fn(stopped, len(daemons))
+	}
+
+	return stopped == len(daemons)
 }
 
 func (c *Client) CephStatusByDaemonName(name string) ([]CephDaemon, error) {
 	parts := strings.SplitN(name, ".", 2)
-	if len(parts) != 2 {
+	if len(parts) != 2 || validateCephName("daemon name", name) != nil {
 		return nil, fmt.Errorf("%q is not a valid daemon name", name)
 	}
-	return c.cephOrchPs("--daemon_type " + parts[0] + " --daemon_id " + parts[1])
+	return c.cephOrchPs("--daemon_type", parts[0], "--daemon_id", parts[1])
 }
 
 func (c *Client) CephFSID() (string, error) {
-	out, err := c.run("sudo ceph fsid")
+	out, err := c.output(sudo("ceph", "fsid"))
 	if err != nil {
 		return "", fmt.Errorf("ceph fsid: %w", err)
 	}
@@ -353,7 +411,7 @@ type CephService struct {
 }
 
 func (c *Client) ListCephServices() ([]CephService, error) {
-	out, err := c.run("sudo ceph orch ls -f json")
+	out, err := c.output(sudo("ceph", "orch", "ls", "-f", "json"))
 	if err != nil {
 		return nil, fmt.Errorf("ceph orch ls: %w", err)
 	}
@@ -367,52 +425,150 @@ func (c *Client) ListCephServices() ([]CephService, error) {
 }
 
 func (c *Client) StopSystemdService(name string) error {
-	if _, err := c.run("sudo systemctl stop " + name); err != nil {
+	if err := validate("systemd unit", name, unitRegexp); err != nil {
+		return err
+	}
+
+	if _, err := c.output(sudo("systemctl", "stop", "--", name)); err != nil {
 		return fmt.Errorf("systemctl stop: %w", err)
 	}
 	return nil
 }
 
+// udpBroadcastScript sends a UDP datagram with broadcasts enabled. Python
+// is used because it is available on most distributions, while tools like
+// socat or etherwake usually are not.
+const udpBroadcastScript = `import socket, sys
+host, port = sys.argv[1].rsplit(":", 1)
+s = socket.socket(socket.AF_INET, socket.SOCK_DGRAM)
+s.setsockopt(socket.SOL_SOCKET, socket.SO_BROADCAST, 1)
+for _ in range(int(sys.argv[3])):
+    s.sendto(bytes.fromhex(sys.argv[2]), (host.strip("[]"), int(port)))`
+
+// SendUDPBroadcast sends the payload to addr from the remote host.
+func (c *Client) SendUDPBroadcast(addr string, payload []byte, repeat int) error {
+	cmd := command("python3", "-c", udpBroadcastScript, addr, hex.EncodeToString(payload), strconv.Itoa(repeat))
+	if _, err := c.output(cmd); err != nil {
+		return fmt.Errorf("send udp: %w", err)
+	}
+	return nil
+}
+
 func (c *Client) Shutdown() error {
-	if _, err := c.run("sudo shutdown"); err != nil {
+	if _, err := c.output(sudo("shutdown")); err != nil {
 		return fmt.Errorf("shutdown: %w", err)
 	}
 	return nil
 }
 
+// Close closes the connection, unless it is shared through a pool.
 func (c *Client) Close() error {
-	return c.ssh.Close()
+	if c.pooled {
+		return nil
+	}
+	return c.close()
+}
+
+func (c *Client) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.disconnect()
 }
 
-func (c *Client) run(cmd string) (string, error) {
-	sess, err := c.ssh.NewSession()
+// conn returns the current connection, connecting if there is none.
+func (c *Client) conn() (*ssh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ssh == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.ssh, nil
+}
+
+// reconnect replaces the broken connection, unless another goroutine has
+// done so already.
+func (c *Client) reconnect(broken *ssh.Client) (*ssh.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ssh == broken {
+		c.disconnect()
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.ssh, nil
+}
+
+// connect must be called with mu held.
+func (c *Client) connect() error {
+	config, closer, err := clientConfig(c.node)
 	if err != nil {
-		return "", fmt.Errorf("new session: %w", err)
+		return err
 	}
-	defer sess.Close()
+	defer closer()
 
-	c.buf.Reset()
+	jumps, err := dialJumps(c.node)
+	if err != nil {
+		return err
+	}
+
+	client, err := dialFrom(jumps, c.node.Addr, config)
+	if err != nil {
+		closeAll(jumps)
+		return err
+	}
+
+	c.ssh = client
+	c.jumps = jumps
+	c.done = make(chan struct{})
+
+	if c.keepAlive > 0 {
+		go keepAlive(client, c.keepAlive, c.done)
+	}
 
-	sess.Stdout = c.buf
+	return nil
+}
 
-	if err := sess.Run(cmd); err != nil {
-		// Output can be incomplete or missing, but return everything we have
-		// to allow inspecting output for specific errors or sentinel values.
-		return c.buf.String(), fmt.Errorf("run command: %w", err)
+// disconnect must be called with mu held.
+func (c *Client) disconnect() error {
+	if c.ssh == nil {
+		return nil
 	}
 
-	return c.buf.String(), nil
+	close(c.done)
+	err := c.ssh.Close()
+	closeAll(c.jumps)
+
+	c.ssh, c.jumps, c.done = nil, nil, nil
+
+	return err
 }
 
-func expandTilde(filename string) (string, error) {
-	if !strings.HasPrefix(filename, "~") {
-		return filename, nil
+// session opens a new session, reconnecting once if the connection is
+// broken. Commands themselves are never retried, as they may not be safe
+// to run twice.
+func (c *Client) session() (*ssh.Session, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := conn.NewSession()
+	if err == nil {
+		return sess, nil
 	}
 
-	home, err := os.UserHomeDir()
+	conn, err = c.reconnect(conn)
 	if err != nil {
-		return "", fmt.Errorf("get home directory: %w", err)
+		return nil, fmt.Errorf("reconnect: %w", err)
 	}
 
-	return strings.Replace(filename, "~", home, 1), nil
+	return conn.NewSession()
 }
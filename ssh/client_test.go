@@ -0,0 +1,25 @@
+package ssh
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestActiveCleanPGs(t *testing.T) {
+	var status CephStatus
+	err := json.Unmarshal([]byte(`{"pgmap": {"num_pgs": 12, "pgs_by_state": [
+		{"state_name": "active+clean", "count": 5},
+		{"state_name": "active+clean+scrubbing", "count": 2},
+		{"state_name": "active+clean+scrubbing+deep", "count": 1},
+		{"state_name": "active+remapped+backfilling", "count": 2},
+		{"state_name": "clean+peered", "count": 1},
+		{"state_name": "active+undersized+degraded", "count": 1}
+	]}}`), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := status.ActiveCleanPGs(); got != 8 {
+		t.Errorf("got %d active+clean PGs, want 8", got)
+	}
+}
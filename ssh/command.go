@@ -0,0 +1,78 @@
+package ssh
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// hostnameRegexp matches DNS labels and FQDNs, which is what ceph
+	// accepts as host names.
+	hostnameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*$`)
+
+	// cephNameRegexp matches ceph daemon types, daemon IDs and service
+	// names, e.g. "osd", "mon.ceph1", "rgw.lab.ceph2.abcdef".
+	cephNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+	// flagRegexp matches OSD flags, e.g. "noout".
+	flagRegexp = regexp.MustCompile(`^[a-z]+$`)
+
+	// unitRegexp matches systemd unit names, e.g. "ceph-<fsid>@mon.ceph1".
+	unitRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:-]*$`)
+
+	// safeRegexp matches arguments that don't need quoting.
+	safeRegexp = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+)
+
+// command joins the program and its arguments into a command line,
+// quoting every argument, so that values from configuration or command
+// line arguments can't inject shell.
+func command(name string, args ...string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, quote(name))
+	for _, arg := range args {
+		quoted = append(quoted, quote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// sudo is like command, but runs the program as root.
+func sudo(name string, args ...string) string {
+	return command("sudo", append([]string{name}, args...)...)
+}
+
+// quote returns the argument quoted for POSIX shells. Single quotes can't
+// be escaped inside single quotes, so they are closed, escaped and opened
+// again.
+func quote(s string) string {
+	if safeRegexp.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func validate(kind, value string, re *regexp.Regexp) error {
+	if !re.MatchString(value) {
+		return fmt.Errorf("%q is not a valid %s", value, kind)
+	}
+	return nil
+}
+
+func validateHostname(hostname string) error {
+	return validate("hostname", hostname, hostnameRegexp)
+}
+
+func validateCephName(kind, name string) error {
+	return validate(kind, name, cephNameRegexp)
+}
+
+// osdArgs converts OSD IDs to command arguments.
+func osdArgs(ids []int) []string {
+	args := make([]string, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, strconv.Itoa(id))
+	}
+	return args
+}
@@ -0,0 +1,523 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// hostile are values that would run, or change, commands if they reached
+// the remote shell unquoted.
+var hostile = []string{
+	"with space",
+	"it's",
+	`"double"`,
+	"$(touch pwned)",
+	"`touch pwned`",
+	"a;touch pwned",
+	"a\ntouch pwned",
+	"a|touch pwned&",
+	"-rf",
+	"--help",
+}
+
+func TestCommand(t *testing.T) {
+	type test struct {
+		name string
+		cmd  string
+		want []string
+	}
+
+	tests := []test{
+		{"plain", command("ls", "-l", "/tmp"), []string{"ls", "-l", "/tmp"}},
+		{"empty", command("echo", ""), []string{"echo", ""}},
+		{"sudo", sudo("ceph", "osd", "set", "noout"), []string{"sudo", "ceph", "osd", "set", "noout"}},
+	}
+	for _, v := range hostile {
+		tests = append(tests,
+			test{"command " + v, command("echo", "--", v), []string{"echo", "--", v}},
+			test{"sudo " + v, sudo(v, v), []string{"sudo", v, v}},
+		)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shellArgs(t, tt.cmd); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s parsed as %q, want %q", tt.cmd, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate func(string) error
+		valid    []string
+	}{
+		{"hostname", validateHostname, []string{"ceph1", "ceph-1.lab.example.com"}},
+		{"ceph name", func(s string) error { return validateCephName("daemon name", s) }, []string{"osd", "mon.ceph1", "rgw.lab.ceph2.abcdef"}},
+		{"osd flag", func(s string) error { return validate("osd flag", s, flagRegexp) }, []string{"noout", "pause"}},
+		{"systemd unit", func(s string) error { return validate("systemd unit", s, unitRegexp) }, []string{"ceph-0b1c@mon.ceph1", "ceph.target"}},
+		{"ceph release", config.ValidateCephRelease, []string{"19.2.3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, v := range tt.valid {
+				if err := tt.validate(v); err != nil {
+					t.Errorf("%q: %v", v, err)
+				}
+			}
+			for _, v := range append([]string{""}, hostile...) {
+				if err := tt.validate(v); err == nil {
+					t.Errorf("%q: expected error", v)
+				}
+			}
+		})
+	}
+}
+
+// TestClientCommands feeds hostile values to every method that builds a
+// remote command, and checks that they are either rejected before
+// anything runs, or reach the program as a single argument that can't be
+// mistaken for an option.
+func TestClientCommands(t *testing.T) {
+	srv := newTestServer(t)
+
+	c, err := New(srv.node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	etcd := config.Etcd{
+		Etcdctl:  "etcdctl",
+		Etcdutl:  "etcdutl",
+		Endpoint: "https://127.0.0.1:2379",
+		CACert:   "/etc/kubernetes/pki/etcd/ca.crt",
+		Cert:     "/etc/kubernetes/pki/etcd/server.crt",
+		Key:      "/etc/kubernetes/pki/etcd/server.key",
+	}
+	etcdctlArgs := func(endpoint string) []string {
+		return []string{"sudo", "etcdctl", "--endpoints=" + endpoint, "--cacert=" + etcd.CACert, "--cert=" + etcd.Cert, "--key=" + etcd.Key}
+	}
+
+	tests := []struct {
+		name string
+		call func(v string) error
+		// want returns commands that must run for the value, or nil if
+		// the value must be rejected.
+		want func(v string) [][]string
+	}{
+		{
+			name: "Compress",
+			call: func(v string) error { return c.Compress(v, nil) },
+			want: func(v string) [][]string { return [][]string{{"zstd", "--rm", "--progress", "--", v}} },
+		},
+		{
+			name: "Decompress",
+			call: func(v string) error { return c.Decompress(v, nil) },
+			want: func(v string) [][]string { return [][]string{{"zstd", "-d", "--rm", "--progress", "--", v}} },
+		},
+		{
+			name: "FileSize",
+			call: func(v string) error { _, err := c.FileSize(v); return err },
+			want: func(v string) [][]string { return [][]string{{"stat", "-c", "%s", "--", v}} },
+		},
+		{
+			name: "SHA512Sum",
+			call: func(v string) error { _, err := c.SHA512Sum(v); return err },
+			want: func(v string) [][]string { return [][]string{{"sha512sum", "--", v}} },
+		},
+		{
+			name: "RemoveTempDir",
+			call: func(v string) error { return c.RemoveTempDir(tempDirPrefix + v) },
+			want: func(v string) [][]string { return [][]string{{"sudo", "rm", "-rf", "--", tempDirPrefix + v}} },
+		},
+		{
+			name: "Move src",
+			call: func(v string) error { return c.Move(v, "/dst") },
+			want: func(v string) [][]string { return [][]string{{"sudo", "mv", "--", v, "/dst"}} },
+		},
+		{
+			name: "Move dst",
+			call: func(v string) error { return c.Move("/src", v) },
+			want: func(v string) [][]string { return [][]string{{"sudo", "mv", "--", "/src", v}} },
+		},
+		{
+			name: "MakeDir",
+			call: func(v string) error { return c.MakeDir(v) },
+			want: func(v string) [][]string { return [][]string{{"sudo", "mkdir", "-p", "--", v}} },
+		},
+		{
+			name: "RemoveDir",
+			call: func(v string) error { return c.RemoveDir(v) },
+			want: func(v string) [][]string { return [][]string{{"sudo", "rmdir", "--", v}} },
+		},
+		{
+			name: "ContainersRunning",
+			call: func(v string) error { _, err := c.ContainersRunning(v); return err },
+			want: func(v string) [][]string { return [][]string{{"sudo", "crictl", "ps", "-q", "--name=" + v}} },
+		},
+		{
+			name: "SendUDPBroadcast",
+			call: func(v string) error { return c.SendUDPBroadcast(v, []byte{0xff}, 1) },
+			want: func(v string) [][]string {
+				return [][]string{{"python3", "-c", udpBroadcastScript, v, "ff", "1"}}
+			},
+		},
+		{
+			name: "SnapshotETCD",
+			call: func(v string) error { return c.SnapshotETCD(etcd, v, nil) },
+			want: func(v string) [][]string {
+				return [][]string{
+					append(etcdctlArgs(etcd.Endpoint), "snapshot", "save", "--", v),
+					{"sudo", "chown", "labctl:labctl", "--", v},
+				}
+			},
+		},
+		{
+			name: "EtcdEndpointHealth",
+			call: func(v string) error {
+				e := etcd
+				e.Endpoint = v
+				_, err := c.EtcdEndpointHealth(e)
+				return err
+			},
+			want: func(v string) [][]string {
+				return [][]string{append(etcdctlArgs(v), "endpoint", "health", "-w", "json")}
+			},
+		},
+		{
+			name: "EtcdSnapshotStatus",
+			call: func(v string) error { _, err := c.EtcdSnapshotStatus(etcd, v); return err },
+			want: func(v string) [][]string {
+				return [][]string{{"sudo", "etcdutl", "snapshot", "status", "-w", "json", "--", v}}
+			},
+		},
+		{
+			name: "EtcdSnapshotRestore filename",
+			call: func(v string) error {
+				return c.EtcdSnapshotRestore(etcd, v, "/var/lib/etcd.restore", EtcdMember{}, nil)
+			},
+			want: func(v string) [][]string {
+				return [][]string{{"sudo", "etcdutl", "snapshot", "restore", "--data-dir=/var/lib/etcd.restore", "--", v}}
+			},
+		},
+		{
+			name: "EtcdSnapshotRestore member",
+			call: func(v string) error {
+				member := EtcdMember{Name: v, InitialCluster: v, PeerURLs: v}
+				return c.EtcdSnapshotRestore(etcd, "/tmp/snapshot.db", v, member, nil)
+			},
+			want: func(v string) [][]string {
+				return [][]string{{
+					"sudo", "etcdutl", "snapshot", "restore", "--data-dir=" + v, "--name=" + v,
+					"--initial-cluster=" + v, "--initial-advertise-peer-urls=" + v, "--", "/tmp/snapshot.db",
+				}}
+			},
+		},
+		{
+			name: "CephEnterMaintenance",
+			call: func(v string) error { return c.CephEnterMaintenance(v) },
+		},
+		{
+			name: "CephExitMaintenance",
+			call: func(v string) error { return c.CephExitMaintenance(v) },
+		},
+		{
+			name: "CephInMaintenance",
+			call: func(v string) error { _, err := c.CephInMaintenance(v); return err },
+		},
+		{
+			name: "SetOSDFlag",
+			call: func(v string) error { return c.SetOSDFlag(v) },
+		},
+		{
+			name: "UnsetOSDFlag",
+			call: func(v string) error { return c.UnsetOSDFlag(v) },
+		},
+		{
+			name: "StopCephService",
+			call: func(v string) error { return c.StopCephService(context.Background(), v, nil) },
+		},
+		{
+			name: "StopCephDaemon",
+			call: func(v string) error { return c.StopCephDaemon(context.Background(), v, nil) },
+		},
+		{
+			name: "CephStatusByServiceName",
+			call: func(v string) error { _, err := c.CephStatusByServiceName(v); return err },
+		},
+		{
+			name: "CephStatusByHost",
+			call: func(v string) error { _, err := c.CephStatusByHost(v); return err },
+		},
+		{
+			name: "CephStatusByDaemonType",
+			call: func(v string) error { _, err := c.CephStatusByDaemonType(v); return err },
+		},
+		{
+			name: "CephStatusByDaemonName",
+			call: func(v string) error { _, err := c.CephStatusByDaemonName(v); return err },
+		},
+		{
+			name: "StopSystemdService",
+			call: func(v string) error { return c.StopSystemdService(v) },
+		},
+		{
+			name: "CephOSDsByHost",
+			call: func(v string) error { _, err := c.CephOSDsByHost(v); return err },
+		},
+		{
+			name: "CephUpgradeCheck",
+			call: func(v string) error { _, err := c.CephUpgradeCheck(v); return err },
+		},
+		{
+			name: "CephUpgradeStart",
+			call: func(v string) error { return c.CephUpgradeStart(v) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, v := range hostile {
+				srv.reset()
+				err := tt.call(v)
+				cmds := srv.reset()
+
+				if tt.want == nil {
+					if err == nil || len(cmds) > 0 {
+						t.Errorf("%q: expected to be rejected, got error %v and commands %q", v, err, cmds)
+					}
+					continue
+				}
+
+				want := tt.want(v)
+				if len(cmds) != len(want) {
+					t.Fatalf("%q: got commands %q, want %d", v, cmds, len(want))
+				}
+				for i, cmd := range cmds {
+					if got := shellArgs(t, cmd); !reflect.DeepEqual(got, want[i]) {
+						t.Errorf("%q: %s parsed as %q, want %q", v, cmd, got, want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+// shellArgs returns the arguments the shell would run cmd with. It runs in
+// an empty directory, which must stay empty if nothing was injected.
+func shellArgs(t *testing.T, cmd string) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	sh := exec.Command("sh", "-c", "set -- "+cmd+"\nprintf '%s\\000' \"$@\"")
+	sh.Dir = dir
+	out, err := sh.Output()
+	if err != nil {
+		t.Fatalf("sh: %v", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("%s created %s", cmd, entries[0].Name())
+	}
+
+	args := strings.Split(string(out), "\x00")
+	return args[:len(args)-1]
+}
+
+// testServer is an SSH server that records commands instead of running
+// them. Commands succeed without output, unless a reply is set for them.
+// SFTP is served from the local filesystem.
+type testServer struct {
+	// node connects to the server using a password and knows it by its
+	// ED25519 host key.
+	node    config.Node
+	hostKey ssh.PublicKey
+
+	mu      sync.Mutex
+	cmds    []string
+	replies map[string]testReply
+
+	// authorized are public keys the server accepts, in addition to any
+	// password.
+	authorized []ssh.PublicKey
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	// Server has an ECDSA key as well, which x/crypto prefers unless it is
+	// told which key the node is known by.
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSigner, err := ssh.NewSignerFromKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	s := &testServer{
+		hostKey: signer.PublicKey(),
+		node: config.Node{
+			Name:        "test",
+			Addr:        l.Addr().String(),
+			Username:    "labctl",
+			Password:    "labctl",
+			AuthMethods: []string{AuthPassword},
+			HostKey:     string(ssh.MarshalAuthorizedKey(signer.PublicKey())),
+		},
+	}
+
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			for _, k := range s.authorized {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("unknown public key")
+		},
+	}
+	cfg.AddHostKey(ecSigner)
+	cfg.AddHostKey(signer)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, cfg)
+		}
+	}()
+
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+
+		ch, chReqs, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(ch, chReqs)
+	}
+}
+
+func (s *testServer) session(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+
+	for req := range reqs {
+		if req.Type == "subsystem" && string(req.Payload[4:]) == "sftp" {
+			req.Reply(true, nil)
+			if srv, err := sftp.NewServer(ch); err == nil {
+				srv.Serve()
+				srv.Close()
+			}
+			return
+		}
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+
+		var exec struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+
+		s.mu.Lock()
+		s.cmds = append(s.cmds, exec.Command)
+		reply := s.replies[exec.Command]
+		s.mu.Unlock()
+
+		io.WriteString(ch, reply.stdout)
+		ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{reply.status}))
+		return
+	}
+}
+
+// testReply is what the server answers a command with.
+type testReply struct {
+	stdout string
+	status uint32
+}
+
+// reply makes the server answer the command with the output and exit
+// status.
+func (s *testServer) reply(cmd, stdout string, status uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.replies == nil {
+		s.replies = make(map[string]testReply)
+	}
+	s.replies[cmd] = testReply{stdout: stdout, status: status}
+}
+
+// reset returns recorded commands and forgets them.
+func (s *testServer) reset() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmds := s.cmds
+	s.cmds = nil
+	return cmds
+}
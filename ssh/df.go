@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type CephDf struct {
+	Stats struct {
+		TotalBytes        uint64  `json:"total_bytes"`
+		TotalAvailBytes   uint64  `json:"total_avail_bytes"`
+		TotalUsedRawBytes uint64  `json:"total_used_raw_bytes"`
+		TotalUsedRawRatio float64 `json:"total_used_raw_ratio"`
+	} `json:"stats"`
+	Pools []CephPoolDf `json:"pools"`
+}
+
+type CephPoolDf struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Stats struct {
+		Stored      uint64  `json:"stored"`
+		Objects     uint64  `json:"objects"`
+		BytesUsed   uint64  `json:"bytes_used"`
+		PercentUsed float64 `json:"percent_used"`
+		MaxAvail    uint64  `json:"max_avail"`
+	} `json:"stats"`
+}
+
+// CephFullRatios are the cluster-wide thresholds at which OSDs are
+// considered nearly full or full. Writes are blocked once an OSD is full.
+type CephFullRatios struct {
+	Full         float64 `json:"full_ratio"`
+	BackfillFull float64 `json:"backfillfull_ratio"`
+	NearFull     float64 `json:"nearfull_ratio"`
+}
+
+func (c *Client) CephDf() (*CephDf, error) {
+	out, err := c.output(sudo("ceph", "df", "detail", "-f", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("ceph df: %w", err)
+	}
+
+	var df CephDf
+	if err := json.Unmarshal([]byte(out), &df); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return &df, nil
+}
+
+func (c *Client) CephFullRatios() (*CephFullRatios, error) {
+	out, err := c.output(sudo("ceph", "osd", "dump", "-f", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("ceph osd dump: %w", err)
+	}
+
+	var ratios CephFullRatios
+	if err := json.Unmarshal([]byte(out), &ratios); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return &ratios, nil
+}
@@ -0,0 +1,90 @@
+package ssh
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// clientConfig returns SSH client configuration for the node. Returned
+// closer must be called once the connection is established.
+func clientConfig(node config.Node) (*ssh.ClientConfig, func(), error) {
+	hostKeyCallback, err := hostKeyCallback(node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hostKeyAlgorithms, err := hostKeyAlgorithms(node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auth, closeAgent, err := authMethods(node)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:              node.Username,
+		Auth:              auth,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: hostKeyAlgorithms,
+	}
+
+	return config, closeAgent, nil
+}
+
+// dialJumps connects through the jump hosts of the node in order. The
+// last client is the one the node itself must be dialed from.
+func dialJumps(node config.Node) ([]*ssh.Client, error) {
+	var jumps []*ssh.Client
+	for _, jump := range node.Jumps {
+		config, closer, err := clientConfig(jump)
+		if err != nil {
+			closeAll(jumps)
+			return nil, fmt.Errorf("jump host %s: %w", jump.Name, err)
+		}
+
+		client, err := dialFrom(jumps, jump.Addr, config)
+		closer()
+		if err != nil {
+			closeAll(jumps)
+			return nil, fmt.Errorf("jump host %s: %w", jump.Name, err)
+		}
+
+		jumps = append(jumps, client)
+	}
+
+	return jumps, nil
+}
+
+// dialFrom dials the address from the last jump host, or directly if
+// there are none.
+func dialFrom(jumps []*ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if len(jumps) == 0 {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	conn, err := jumps[len(jumps)-1].Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// closeAll closes clients in reverse order, so that tunnels are torn
+// down before the connections they run through.
+func closeAll(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
@@ -0,0 +1,274 @@
+package ssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+const (
+	// ManifestsDir is where kubelet looks for static pod manifests.
+	ManifestsDir = "/etc/kubernetes/manifests"
+
+	// adminKubeconfig is written by kubeadm on control plane nodes.
+	adminKubeconfig = "/etc/kubernetes/admin.conf"
+)
+
+// etcdctl returns etcdctl command connecting to the local etcd member.
+// Only root can read certs for connecting to the etcd cluster.
+func etcdctl(etcd config.Etcd, args ...string) string {
+	return sudo(etcd.Etcdctl, append([]string{
+		"--endpoints=" + etcd.Endpoint,
+		"--cacert=" + etcd.CACert,
+		"--cert=" + etcd.Cert,
+		"--key=" + etcd.Key,
+	}, args...)...)
+}
+
+// SnapshotETCD saves etcd snapshot to filename. Output of etcdctl is
+// passed to fn as it arrives, fn may be nil.
+func (c *Client) SnapshotETCD(etcd config.Etcd, filename string, fn LineFunc) error {
+	if _, err := c.RunStream(etcdctl(etcd, "snapshot", "save", "--", filename), fn); err != nil {
+		return fmt.Errorf("save: %w", err)
+	}
+
+	// Update file permissions to allow scp'ing the snapshot back to local machine.
+	cmd := sudo("chown", c.node.Username+":"+c.node.Username, "--", filename)
+	if _, err := c.output(cmd); err != nil {
+		return fmt.Errorf("chown: %w", err)
+	}
+
+	return nil
+}
+
+// EtcdEndpointHealth reports whether the local etcd member is healthy.
+func (c *Client) EtcdEndpointHealth(etcd config.Etcd) (bool, error) {
+	// Unhealthy endpoints make etcdctl exit with an error, but the report
+	// is still written to stdout.
+	out, err := c.output(etcdctl(etcd, "endpoint", "health", "-w", "json"))
+
+	var health []struct {
+		Health bool   `json:"health"`
+		Error  string `json:"error"`
+	}
+	if jsonErr := json.Unmarshal([]byte(out), &health); jsonErr != nil || len(health) == 0 {
+		if err != nil {
+			return false, fmt.Errorf("etcdctl endpoint health: %w", err)
+		}
+		return false, fmt.Errorf("json: %w", jsonErr)
+	}
+
+	return health[0].Health, nil
+}
+
+// EtcdEndpointStatus is reported by `etcdctl endpoint status`.
+type EtcdEndpointStatus struct {
+	Endpoint string `json:"Endpoint"`
+	Status   struct {
+		Header struct {
+			MemberID uint64 `json:"member_id"`
+			Revision int64  `json:"revision"`
+		} `json:"header"`
+		Version string `json:"version"`
+		DBSize  int64  `json:"dbSize"`
+		Leader  uint64 `json:"leader"`
+	} `json:"Status"`
+}
+
+// IsLeader reports whether the member is the raft leader.
+func (s *EtcdEndpointStatus) IsLeader() bool {
+	return s.Status.Header.MemberID == s.Status.Leader
+}
+
+// EtcdEndpointStatus returns status of the local etcd member.
+func (c *Client) EtcdEndpointStatus(etcd config.Etcd) (*EtcdEndpointStatus, error) {
+	out, err := c.output(etcdctl(etcd, "endpoint", "status", "-w", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("etcdctl endpoint status: %w", err)
+	}
+
+	var status []EtcdEndpointStatus
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+	if len(status) == 0 {
+		return nil, fmt.Errorf("etcdctl endpoint status: no endpoints")
+	}
+
+	return &status[0], nil
+}
+
+// EtcdClusterMember is reported by `etcdctl member list`.
+type EtcdClusterMember struct {
+	ID         uint64   `json:"ID"`
+	Name       string   `json:"name"`
+	PeerURLs   []string `json:"peerURLs"`
+	ClientURLs []string `json:"clientURLs"`
+	IsLearner  bool     `json:"isLearner"`
+}
+
+// EtcdMembers returns all members of the etcd cluster.
+func (c *Client) EtcdMembers(etcd config.Etcd) ([]EtcdClusterMember, error) {
+	out, err := c.output(etcdctl(etcd, "member", "list", "-w", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("etcdctl member list: %w", err)
+	}
+
+	var list struct {
+		Members []EtcdClusterMember `json:"members"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return list.Members, nil
+}
+
+// EtcdSnapshotStatus is reported by `etcdutl snapshot status`.
+type EtcdSnapshotStatus struct {
+	Hash      uint32 `json:"hash"`
+	Revision  int64  `json:"revision"`
+	TotalKey  int    `json:"totalKey"`
+	TotalSize int64  `json:"totalSize"`
+	Version   string `json:"version"`
+}
+
+// EtcdSnapshotStatus verifies the snapshot file and returns its status.
+func (c *Client) EtcdSnapshotStatus(etcd config.Etcd, filename string) (*EtcdSnapshotStatus, error) {
+	out, err := c.output(sudo(etcd.Etcdutl, "snapshot", "status", "-w", "json", "--", filename))
+	if err != nil {
+		return nil, fmt.Errorf("etcdutl snapshot status: %w", err)
+	}
+
+	var status EtcdSnapshotStatus
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return &status, nil
+}
+
+// EtcdSnapshotRestore restores the snapshot into a new data directory.
+// Member name and peer URLs must match the ones etcd is started with, so
+// that the restored member can rejoin itself.
+func (c *Client) EtcdSnapshotRestore(etcd config.Etcd, filename, dataDir string, member EtcdMember, fn LineFunc) error {
+	args := []string{"snapshot", "restore", "--data-dir=" + dataDir}
+	if member.Name != "" {
+		args = append(args, "--name="+member.Name)
+	}
+	if member.InitialCluster != "" {
+		args = append(args, "--initial-cluster="+member.InitialCluster)
+	}
+	if member.PeerURLs != "" {
+		args = append(args, "--initial-advertise-peer-urls="+member.PeerURLs)
+	}
+	args = append(args, "--", filename)
+
+	if _, err := c.RunStream(sudo(etcd.Etcdutl, args...), fn); err != nil {
+		return fmt.Errorf("etcdutl snapshot restore: %w", err)
+	}
+
+	return nil
+}
+
+// EtcdMember is the configuration of the local etcd member, as passed to
+// etcd in its static pod manifest.
+type EtcdMember struct {
+	Name           string
+	DataDir        string
+	InitialCluster string
+	PeerURLs       string
+}
+
+// EtcdMember reads the configuration of the local etcd member from its
+// static pod manifest.
+func (c *Client) EtcdMember() (*EtcdMember, error) {
+	out, err := c.output(sudo("cat", "--", ManifestsDir+"/etcd.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("read etcd manifest: %w", err)
+	}
+
+	// Flags are listed one per line, e.g. "    - --data-dir=/var/lib/etcd".
+	flags := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		line = strings.TrimPrefix(line, "- ")
+		if !strings.HasPrefix(line, "--") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(strings.TrimPrefix(line, "--"), "=")
+		flags[key] = strings.Trim(value, `"'`)
+	}
+
+	member := &EtcdMember{
+		Name:           flags["name"],
+		DataDir:        flags["data-dir"],
+		InitialCluster: flags["initial-cluster"],
+		PeerURLs:       flags["initial-advertise-peer-urls"],
+	}
+	if member.DataDir == "" {
+		return nil, fmt.Errorf("data dir is not set in etcd manifest")
+	}
+
+	return member, nil
+}
+
+// Decompress decompresses the zstd file, replacing it with a file without
+// the .zst extension. Progress is passed to fn, which may be nil.
+func (c *Client) Decompress(filename string, fn LineFunc) error {
+	if _, err := c.RunStream(command("zstd", "-d", "--rm", "--progress", "--", filename), fn); err != nil {
+		return fmt.Errorf("zstd: %w", err)
+	}
+	return nil
+}
+
+// Move renames the file or directory as root.
+func (c *Client) Move(src, dst string) error {
+	if _, err := c.output(sudo("mv", "--", src, dst)); err != nil {
+		return fmt.Errorf("mv: %w", err)
+	}
+	return nil
+}
+
+// MakeDir creates the directory, and any missing parents, as root.
+func (c *Client) MakeDir(dir string) error {
+	if _, err := c.output(sudo("mkdir", "-p", "--", dir)); err != nil {
+		return fmt.Errorf("mkdir: %w", err)
+	}
+	return nil
+}
+
+// RemoveDir removes the empty directory as root.
+func (c *Client) RemoveDir(dir string) error {
+	if _, err := c.output(sudo("rmdir", "--", dir)); err != nil {
+		return fmt.Errorf("rmdir: %w", err)
+	}
+	return nil
+}
+
+// ContainersRunning reports whether any container with the name is
+// running on the node.
+func (c *Client) ContainersRunning(name string) (bool, error) {
+	out, err := c.output(sudo("crictl", "ps", "-q", "--name="+name))
+	if err != nil {
+		return false, fmt.Errorf("crictl ps: %w", err)
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+// APIServerReady reports whether the local API server answers its
+// readiness check.
+func (c *Client) APIServerReady() (bool, error) {
+	out, err := c.output(sudo("kubectl", "--kubeconfig", adminKubeconfig, "get", "--raw", "/readyz"))
+	if err != nil {
+		// API server is expected to be unavailable while it is starting.
+		return false, nil
+	}
+	return strings.TrimSpace(out) == "ok", nil
+}
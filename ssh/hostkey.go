@@ -0,0 +1,312 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// KnownHostsFile is where host keys are looked up when the node doesn't
+// have them configured.
+const KnownHostsFile = "~/.ssh/known_hosts"
+
+// knownHostsMu serializes access to known_hosts, so that connecting to
+// many nodes at once doesn't corrupt it. Other processes are kept out with
+// a file lock while it is written.
+var knownHostsMu sync.Mutex
+
+// errHostKeyScanned aborts the handshake once the host key is captured.
+var errHostKeyScanned = errors.New("host key scanned")
+
+// hostKeyCallback verifies host keys against keys configured for the node,
+// or against known_hosts if none are configured. Unknown hosts are added
+// to known_hosts if the node opts in to trust on first use.
+func hostKeyCallback(node config.Node) (ssh.HostKeyCallback, error) {
+	keys, err := configuredHostKeys(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) > 0 {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			for _, k := range keys {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return nil
+				}
+			}
+			return fmt.Errorf("host key %s %s of %s does not match configured host keys", key.Type(), ssh.FingerprintSHA256(key), node.Name)
+		}, nil
+	}
+
+	path, err := config.ExpandTilde(KnownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := checkKnownHosts(path, hostname, remote, key)
+
+		// Changed keys are never trusted automatically.
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err
+		}
+
+		if !node.TrustOnFirstUse {
+			return fmt.Errorf("%s is not in %s, run `labctl ssh trust %s` to add it", hostname, KnownHostsFile, node.Name)
+		}
+
+		fmt.Fprintf(os.Stderr, "⚠️  Trusting %s host key %s of %s\n", key.Type(), ssh.FingerprintSHA256(key), node.Name)
+
+		return addKnownHost(path, hostname, remote, key)
+	}, nil
+}
+
+// configuredHostKeys parses host keys given in the node configuration.
+func configuredHostKeys(node config.Node) ([]ssh.PublicKey, error) {
+	var lines []string
+	if node.HostKey != "" {
+		lines = append(lines, node.HostKey)
+	}
+	lines = append(lines, node.HostKeys...)
+
+	keys := make([]ssh.PublicKey, 0, len(lines))
+	for _, line := range lines {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("parse host key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// hostKeyAlgorithms returns host key algorithms to negotiate with the
+// node, derived from the keys it is expected to present. Otherwise the
+// server picks the type x/crypto prefers, e.g. ECDSA over ED25519, and a
+// node known by a key of another type is rejected as changed. Nil means
+// any algorithm, e.g. for nodes that aren't known yet.
+func hostKeyAlgorithms(node config.Node) ([]string, error) {
+	keys, err := configuredHostKeys(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		path, err := config.ExpandTilde(KnownHostsFile)
+		if err != nil {
+			return nil, err
+		}
+
+		keys, err = knownHostKeys(path, node.Addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var algorithms []string
+	for _, key := range keys {
+		keyAlgorithms := []string{key.Type()}
+		if key.Type() == ssh.KeyAlgoRSA {
+			// RSA keys are used with SHA-2 signatures by modern servers.
+			keyAlgorithms = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+
+		for _, algo := range keyAlgorithms {
+			if !slices.Contains(algorithms, algo) {
+				algorithms = append(algorithms, algo)
+			}
+		}
+	}
+
+	return algorithms, nil
+}
+
+// knownHostKeys returns keys known_hosts has for the address.
+func knownHostKeys(path, addr string) ([]ssh.PublicKey, error) {
+	// knownhosts can't look keys up, but it lists the keys it expected
+	// when the host presents a key it doesn't know.
+	err := checkKnownHosts(path, addr, &net.TCPAddr{IP: net.IPv4zero}, probeKey{})
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return nil, err
+	}
+
+	keys := make([]ssh.PublicKey, 0, len(keyErr.Want))
+	for _, k := range keyErr.Want {
+		keys = append(keys, k.Key)
+	}
+
+	return keys, nil
+}
+
+// probeKey is a key no host has.
+type probeKey struct{}
+
+func (probeKey) Type() string {
+	return "labctl-probe"
+}
+
+func (probeKey) Marshal() []byte {
+	return []byte("labctl-probe")
+}
+
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error {
+	return errors.New("probe key can't verify signatures")
+}
+
+// checkKnownHosts verifies the key against known_hosts. Missing file is
+// treated the same as an empty one.
+func checkKnownHosts(path, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	return checkKnownHostsLocked(path, hostname, remote, key)
+}
+
+func checkKnownHostsLocked(path, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return &knownhosts.KeyError{}
+	}
+
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return fmt.Errorf("read known hosts: %w", err)
+	}
+
+	return callback(hostname, remote, key)
+}
+
+// addKnownHost appends the key to known_hosts, unless it is there already.
+// File is checked again once it is locked, as another connection may have
+// added the host since it was checked, or even found it has changed.
+func addKnownHost(path, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("open known hosts: %w", err)
+	}
+	defer f.Close()
+
+	if err := lockFile(f); err != nil {
+		return fmt.Errorf("lock known hosts: %w", err)
+	}
+	defer unlockFile(f)
+
+	err = checkKnownHostsLocked(path, hostname, remote, key)
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+		return err
+	}
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("write known hosts: %w", err)
+	}
+
+	return nil
+}
+
+// ScanHostKey connects to the node and returns the key it presents,
+// without verifying or authenticating. Jump hosts are verified as usual.
+func ScanHostKey(node config.Node) (ssh.PublicKey, error) {
+	jumps, err := dialJumps(node)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll(jumps)
+
+	// Key of the type known_hosts has is scanned, if the node has one, so
+	// that it is recognized as known.
+	algorithms, err := hostKeyAlgorithms(node)
+	if err != nil {
+		return nil, err
+	}
+
+	var scanned ssh.PublicKey
+
+	config := &ssh.ClientConfig{
+		User:              node.Username,
+		HostKeyAlgorithms: algorithms,
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			scanned = key
+			return errHostKeyScanned
+		},
+	}
+
+	client, err := dialFrom(jumps, node.Addr, config)
+	if err == nil {
+		client.Close()
+	}
+	if scanned == nil {
+		return nil, fmt.Errorf("scan host key: %w", err)
+	}
+
+	return scanned, nil
+}
+
+// IsKnownHost reports whether the key is in known_hosts for the node. An
+// error is returned if known_hosts has a different key for the node.
+func IsKnownHost(node config.Node, key ssh.PublicKey) (bool, error) {
+	path, err := config.ExpandTilde(KnownHostsFile)
+	if err != nil {
+		return false, err
+	}
+
+	remote, err := net.ResolveTCPAddr("tcp", node.Addr)
+	if err != nil {
+		return false, fmt.Errorf("resolve addr: %w", err)
+	}
+
+	err = checkKnownHosts(path, node.Addr, remote, key)
+
+	var keyErr *knownhosts.KeyError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &keyErr) && len(keyErr.Want) == 0:
+		return false, nil
+	case errors.As(err, &keyErr):
+		want := make([]string, 0, len(keyErr.Want))
+		for _, k := range keyErr.Want {
+			want = append(want, fmt.Sprintf("%s:%d", k.Filename, k.Line))
+		}
+		return false, fmt.Errorf("host key of %s has changed, see %s", node.Name, strings.Join(want, ", "))
+	default:
+		return false, err
+	}
+}
+
+// TrustHostKey adds the key to known_hosts for the node.
+func TrustHostKey(node config.Node, key ssh.PublicKey) error {
+	path, err := config.ExpandTilde(KnownHostsFile)
+	if err != nil {
+		return err
+	}
+
+	remote, err := net.ResolveTCPAddr("tcp", node.Addr)
+	if err != nil {
+		return fmt.Errorf("resolve addr: %w", err)
+	}
+
+	return addKnownHost(path, node.Addr, remote, key)
+}
@@ -0,0 +1,120 @@
+package ssh
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+func TestHostKeyAlgorithms(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	srv := newTestServer(t)
+	knownHosts := knownhosts.Line([]string{knownhosts.Normalize(srv.node.Addr)}, srv.hostKey)
+
+	tests := []struct {
+		name       string
+		hostKey    string
+		knownHosts string
+	}{
+		{
+			name:    "configured host key",
+			hostKey: srv.node.HostKey,
+		},
+		{
+			name:       "known_hosts",
+			knownHosts: knownHosts + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := config.ExpandTilde(KnownHostsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(tt.knownHosts), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			node := srv.node
+			node.HostKey = tt.hostKey
+
+			// Server prefers to present its ECDSA key, which the node
+			// isn't known by.
+			c, err := New(node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+
+			key, err := ScanHostKey(node)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Type() != srv.hostKey.Type() {
+				t.Errorf("scanned %s key, want %s", key.Type(), srv.hostKey.Type())
+			}
+		})
+	}
+}
+
+func TestAddKnownHost(t *testing.T) {
+	srv := newTestServer(t)
+	other := newTestServer(t)
+
+	remote, err := net.ResolveTCPAddr("tcp", srv.node.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		existing  ssh.PublicKey
+		wantErr   bool
+		wantLines int
+	}{
+		{name: "unknown host", wantLines: 1},
+		// Another connection trusted the host since it was checked.
+		{name: "added meanwhile", existing: srv.hostKey, wantLines: 1},
+		{name: "changed meanwhile", existing: other.hostKey, wantErr: true, wantLines: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "known_hosts")
+			if tt.existing != nil {
+				line := knownhosts.Line([]string{knownhosts.Normalize(srv.node.Addr)}, tt.existing)
+				if err := os.WriteFile(path, []byte(line+"\n"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := addKnownHost(path, srv.node.Addr, remote, srv.hostKey)
+			if tt.wantErr && err == nil {
+				t.Error("expected error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines := strings.Split(strings.TrimSpace(string(b)), "\n"); len(lines) != tt.wantLines {
+				t.Errorf("known_hosts has %d lines, want %d", len(lines), tt.wantLines)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// KubeadmCert is a certificate managed by kubeadm on a control plane node.
+type KubeadmCert struct {
+	Name              string    `json:"name"`
+	ExpirationDate    time.Time `json:"expirationDate"`
+	ExternallyManaged bool      `json:"externallyManaged"`
+
+	// IsCA is set for certificate authorities.
+	IsCA bool `json:"-"`
+}
+
+// KubeadmCerts returns certificates and certificate authorities kubeadm
+// manages on the node, as reported by `kubeadm certs check-expiration`.
+func (c *Client) KubeadmCerts() ([]KubeadmCert, error) {
+	out, err := c.output(sudo("kubeadm", "certs", "check-expiration", "-o", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("kubeadm certs check-expiration: %w", err)
+	}
+
+	var info struct {
+		Certificates           []KubeadmCert `json:"certificates"`
+		CertificateAuthorities []KubeadmCert `json:"certificateAuthorities"`
+	}
+	if err := json.Unmarshal([]byte(out), &info); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	for i := range info.CertificateAuthorities {
+		info.CertificateAuthorities[i].IsCA = true
+	}
+
+	return append(info.Certificates, info.CertificateAuthorities...), nil
+}
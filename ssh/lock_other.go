@@ -0,0 +1,14 @@
+//go:build !unix
+
+package ssh
+
+import "os"
+
+// lockFile does nothing, files are only locked on unix.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,236 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type CephOSDOkToStop struct {
+	OkToStop          bool     `json:"ok_to_stop"`
+	OSDs              []int    `json:"osds"`
+	NumOkPGs          int      `json:"num_ok_pgs"`
+	NumNotOkPGs       int      `json:"num_not_ok_pgs"`
+	BadBecomeInactive []string `json:"bad_become_inactive"`
+	OkBecomeDegraded  []string `json:"ok_become_degraded"`
+}
+
+type CephOSDSafeToDestroy struct {
+	SafeToDestroy []int `json:"safe_to_destroy"`
+	Active        []int `json:"active"`
+	MissingStats  []int `json:"missing_stats"`
+	StoredPGs     []int `json:"stored_pgs"`
+}
+
+type CephPool struct {
+	ID      int    `json:"pool_id"`
+	Name    string `json:"pool_name"`
+	Size    int    `json:"size"`
+	MinSize int    `json:"min_size"`
+}
+
+type CephPG struct {
+	ID            string `json:"pgid"`
+	State         string `json:"state"`
+	Up            []int  `json:"up"`
+	Acting        []int  `json:"acting"`
+	ActingPrimary int    `json:"acting_primary"`
+}
+
+// PoolID returns the ID of the pool the placement group belongs to.
+func (pg CephPG) PoolID() (int, error) {
+	id, _, ok := strings.Cut(pg.ID, ".")
+	if !ok {
+		return 0, fmt.Errorf("%q is not a valid pg id", pg.ID)
+	}
+	return strconv.Atoi(id)
+}
+
+// OnOSDs reports whether any of the OSDs is in the up or acting set of the
+// placement group, i.e. whether it holds data of the placement group or is
+// going to.
+func (pg CephPG) OnOSDs(ids []int) bool {
+	for _, id := range ids {
+		if slices.Contains(pg.Up, id) || slices.Contains(pg.Acting, id) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) CephOSDsByHost(hostname string) ([]int, error) {
+	if err := validateHostname(hostname); err != nil {
+		return nil, err
+	}
+
+	out, err := c.output(sudo("ceph", "osd", "ls-tree", "-f", "json", hostname))
+	if err != nil {
+		return nil, fmt.Errorf("ceph osd ls-tree: %w", err)
+	}
+
+	var ids []int
+	if err := json.Unmarshal([]byte(out), &ids); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return ids, nil
+}
+
+func (c *Client) CephOSDOkToStop(ids []int) (*CephOSDOkToStop, error) {
+	// Ceph exits with EBUSY when the OSDs are not ok to stop, but still
+	// writes the report to stdout, so try to decode it before giving up.
+	out, err := c.output(sudo("ceph", append([]string{"osd", "ok-to-stop", "-f", "json"}, osdArgs(ids)...)...))
+
+	var result CephOSDOkToStop
+	if jsonErr := json.Unmarshal([]byte(out), &result); jsonErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("ceph osd ok-to-stop: %w", err)
+		}
+		return nil, fmt.Errorf("json: %w", jsonErr)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) CephOSDSafeToDestroy(ids []int) (*CephOSDSafeToDestroy, error) {
+	// Same as with ok-to-stop, the report is written to stdout even
+	// if the OSDs are not safe to destroy.
+	out, err := c.output(sudo("ceph", append([]string{"osd", "safe-to-destroy", "-f", "json"}, osdArgs(ids)...)...))
+
+	var result CephOSDSafeToDestroy
+	if jsonErr := json.Unmarshal([]byte(out), &result); jsonErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("ceph osd safe-to-destroy: %w", err)
+		}
+		return nil, fmt.Errorf("json: %w", jsonErr)
+	}
+
+	return &result, nil
+}
+
+func (c *Client) ListCephPools() ([]CephPool, error) {
+	out, err := c.output(sudo("ceph", "osd", "pool", "ls", "detail", "-f", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("ceph osd pool ls: %w", err)
+	}
+
+	var pools []CephPool
+	if err := json.Unmarshal([]byte(out), &pools); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return pools, nil
+}
+
+func (c *Client) ListCephPGs() ([]CephPG, error) {
+	out, err := c.output(sudo("ceph", "pg", "dump", "pgs_brief", "-f", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("ceph pg dump: %w", err)
+	}
+
+	// Newer releases wrap the placement groups in an object, while older
+	// releases return a bare list.
+	var wrapped struct {
+		PGStats []CephPG `json:"pg_stats"`
+	}
+	if err := json.Unmarshal([]byte(out), &wrapped); err == nil {
+		return wrapped.PGStats, nil
+	}
+
+	var pgs []CephPG
+	if err := json.Unmarshal([]byte(out), &pgs); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return pgs, nil
+}
+
+type CephOSDTree struct {
+	Nodes []CephOSDTreeNode `json:"nodes"`
+}
+
+type CephOSDTreeNode struct {
+	ID          int     `json:"id"`
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	DeviceClass string  `json:"device_class"`
+	Children    []int   `json:"children"`
+	CrushWeight float64 `json:"crush_weight"`
+	Reweight    float64 `json:"reweight"`
+	KB          uint64  `json:"kb"`
+	KBUsed      uint64  `json:"kb_used"`
+	Utilization float64 `json:"utilization"`
+	PGs         int     `json:"pgs"`
+	Status      string  `json:"status"`
+}
+
+// In reports whether the OSD is in the cluster and may be assigned data.
+func (n CephOSDTreeNode) In() bool {
+	return n.Reweight > 0
+}
+
+// Hosts returns host names keyed by IDs of the OSDs they contain.
+func (t *CephOSDTree) Hosts() map[int]string {
+	hosts := make(map[int]string)
+	for _, node := range t.Nodes {
+		if node.Type != "host" {
+			continue
+		}
+		for _, child := range node.Children {
+			hosts[child] = node.Name
+		}
+	}
+	return hosts
+}
+
+// OSDs returns OSD nodes sorted by their ID.
+func (t *CephOSDTree) OSDs() []CephOSDTreeNode {
+	var osds []CephOSDTreeNode
+	for _, node := range t.Nodes {
+		if node.Type == "osd" {
+			osds = append(osds, node)
+		}
+	}
+	slices.SortFunc(osds, func(a, b CephOSDTreeNode) int {
+		return a.ID - b.ID
+	})
+	return osds
+}
+
+func (c *Client) CephOSDDfTree() (*CephOSDTree, error) {
+	out, err := c.output(sudo("ceph", "osd", "df", "tree", "-f", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("ceph osd df: %w", err)
+	}
+
+	var tree CephOSDTree
+	if err := json.Unmarshal([]byte(out), &tree); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return &tree, nil
+}
+
+func (c *Client) CephOSDOut(ids []int) error {
+	if _, err := c.output(sudo("ceph", append([]string{"osd", "out"}, osdArgs(ids)...)...)); err != nil {
+		return fmt.Errorf("ceph osd out: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) CephOSDIn(ids []int) error {
+	if _, err := c.output(sudo("ceph", append([]string{"osd", "in"}, osdArgs(ids)...)...)); err != nil {
+		return fmt.Errorf("ceph osd in: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) CephOSDReweight(id int, weight float64) error {
+	cmd := sudo("ceph", "osd", "reweight", strconv.Itoa(id), strconv.FormatFloat(weight, 'f', -1, 64))
+	if _, err := c.output(cmd); err != nil {
+		return fmt.Errorf("ceph osd reweight: %w", err)
+	}
+	return nil
+}
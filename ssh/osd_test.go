@@ -0,0 +1,146 @@
+package ssh
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestCephPGOnOSDs(t *testing.T) {
+	tests := []struct {
+		name string
+		pg   CephPG
+		want bool
+	}{
+		{"up", CephPG{Up: []int{1, 3}, Acting: []int{1, 2}}, true},
+		{"acting while backfilling", CephPG{Up: []int{1, 2}, Acting: []int{1, 3}}, true},
+		{"elsewhere", CephPG{Up: []int{1, 2}, Acting: []int{1, 2}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pg.OnOSDs([]int{3, 4}); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCephOSDOkToStop(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	const cmd = "sudo ceph osd ok-to-stop -f json 1 2"
+
+	tests := []struct {
+		name    string
+		stdout  string
+		status  uint32
+		want    CephOSDOkToStop
+		wantErr bool
+	}{
+		{
+			name:   "ok",
+			stdout: `{"ok_to_stop":true,"osds":[1,2],"num_ok_pgs":3,"num_not_ok_pgs":0,"ok_become_degraded":["1.0","1.1","2.0"]}`,
+			want:   CephOSDOkToStop{OkToStop: true, OSDs: []int{1, 2}, NumOkPGs: 3, OkBecomeDegraded: []string{"1.0", "1.1", "2.0"}},
+		},
+		{
+			// Ceph exits with EBUSY, but still reports which PGs are affected.
+			name:   "not ok",
+			stdout: `{"ok_to_stop":false,"osds":[1,2],"num_ok_pgs":1,"num_not_ok_pgs":2,"bad_become_inactive":["2.0","2.1"],"ok_become_degraded":["1.0"]}`,
+			status: 16,
+			want:   CephOSDOkToStop{OSDs: []int{1, 2}, NumOkPGs: 1, NumNotOkPGs: 2, BadBecomeInactive: []string{"2.0", "2.1"}, OkBecomeDegraded: []string{"1.0"}},
+		},
+		{
+			name:    "failed without report",
+			status:  2,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.reply(cmd, tt.stdout, tt.status)
+
+			got, err := c.CephOSDOkToStop([]int{1, 2})
+			if cmds := srv.reset(); !slices.Equal(cmds, []string{cmd}) {
+				t.Fatalf("ran %q, want %q", cmds, cmd)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCephOSDSafeToDestroy(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// OSDs that still store PGs are not safe to destroy, so ceph exits
+	// with EBUSY.
+	const cmd = "sudo ceph osd safe-to-destroy -f json 1 2"
+	srv.reply(cmd, `{"safe_to_destroy":[2],"active":[],"missing_stats":[],"stored_pgs":[1]}`, 16)
+
+	got, err := c.CephOSDSafeToDestroy([]int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := CephOSDSafeToDestroy{SafeToDestroy: []int{2}, Active: []int{}, MissingStats: []int{}, StoredPGs: []int{1}}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("got %+v, want %+v", *got, want)
+	}
+}
+
+func TestListCephPGs(t *testing.T) {
+	srv := newTestServer(t)
+	c, err := New(srv.node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	const cmd = "sudo ceph pg dump pgs_brief -f json"
+	const pg = `{"pgid":"1.0","state":"active+clean","up":[0,1,2],"up_primary":0,"acting":[0,1,2],"acting_primary":0}`
+	want := []CephPG{{ID: "1.0", State: "active+clean", Up: []int{0, 1, 2}, Acting: []int{0, 1, 2}}}
+
+	tests := []struct {
+		name   string
+		stdout string
+	}{
+		{"wrapped", `{"pg_ready":true,"pg_stats":[` + pg + `]}`},
+		{"bare list of older releases", `[` + pg + `]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.reply(cmd, tt.stdout, 0)
+
+			got, err := c.ListCephPGs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
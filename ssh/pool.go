@@ -0,0 +1,115 @@
+package ssh
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// DefaultKeepAlive is how often keep-alive requests are sent. Connections
+// that don't answer within the same interval are considered broken.
+const DefaultKeepAlive = 15 * time.Second
+
+// Pool shares connections to nodes, so that a command talking to the same
+// node many times only connects once.
+type Pool struct {
+	mu        sync.Mutex
+	clients   map[string]*Client
+	keepAlive time.Duration
+}
+
+func NewPool(keepAlive time.Duration) *Pool {
+	return &Pool{
+		clients:   make(map[string]*Client),
+		keepAlive: keepAlive,
+	}
+}
+
+// Get returns a connected client for the node, reusing an existing
+// connection if there is one. Clients are shared and Close on them does
+// nothing, connections are closed when the pool is closed.
+func (p *Pool) Get(node config.Node) (*Client, error) {
+	key := strings.ToLower(node.Username + "@" + node.Name + "/" + node.Addr)
+
+	p.mu.Lock()
+	c, ok := p.clients[key]
+	if !ok {
+		c = &Client{node: node, keepAlive: p.keepAlive, pooled: true}
+		p.clients[key] = c
+	}
+	p.mu.Unlock()
+
+	// Connecting happens outside of the pool lock, so that connections to
+	// different nodes can be established concurrently.
+	if _, err := c.conn(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Close closes all connections in the pool.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	for key, c := range p.clients {
+		errs = append(errs, c.close())
+		delete(p.clients, key)
+	}
+
+	return errors.Join(errs...)
+}
+
+var defaultPool = NewPool(DefaultKeepAlive)
+
+// Get returns a client for the node from the default pool.
+func Get(node config.Node) (*Client, error) {
+	return defaultPool.Get(node)
+}
+
+// CloseAll closes all connections in the default pool.
+func CloseAll() error {
+	return defaultPool.Close()
+}
+
+// keepAlive sends keep-alive requests until done is closed. Connection is
+// closed if a request fails or isn't answered in time, so that the next
+// session triggers a reconnect instead of hanging.
+func keepAlive(client *ssh.Client, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		errc := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			errc <- err
+		}()
+
+		select {
+		case <-done:
+			return
+		case err := <-errc:
+			if err != nil {
+				client.Close()
+				return
+			}
+		case <-time.After(interval):
+			client.Close()
+			return
+		}
+	}
+}
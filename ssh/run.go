@@ -0,0 +1,165 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Result is the outcome of a remote command.
+type Result struct {
+	Stdout     string
+	Stderr     string
+	ExitStatus int
+	Duration   time.Duration
+}
+
+// ExitError is returned when a remote command exits with a non-zero
+// status. Its message is what the command wrote to stderr, which is
+// usually more helpful than the exit status alone.
+type ExitError struct {
+	Cmd        string
+	ExitStatus int
+	Stderr     string
+}
+
+func (e *ExitError) Error() string {
+	if msg := strings.TrimSpace(e.Stderr); msg != "" {
+		return msg
+	}
+	return fmt.Sprintf("process exited with status %d", e.ExitStatus)
+}
+
+// Stream identifies where a line of output came from.
+type Stream int
+
+const (
+	Stdout Stream = iota
+	Stderr
+)
+
+// LineFunc is called with every line of output as soon as it arrives.
+// Progress updates that end with a carriage return are treated as lines.
+type LineFunc func(stream Stream, line string)
+
+// Run runs the command and returns its result. It is safe to call from
+// multiple goroutines, each call runs in its own session.
+//
+// Result is returned even if the command fails, so that callers can
+// inspect output for specific errors or sentinel values. Non-zero exit
+// status is reported as *ExitError.
+func (c *Client) Run(cmd string) (*Result, error) {
+	return c.RunStream(cmd, nil)
+}
+
+// RunStream is like Run, but also forwards output to fn line by line
+// while the command is running. Callback is never called concurrently.
+func (c *Client) RunStream(cmd string, fn LineFunc) (*Result, error) {
+	sess, err := c.session()
+	if err != nil {
+		return nil, fmt.Errorf("new session: %w", err)
+	}
+	defer sess.Close()
+
+	var stdout, stderr bytes.Buffer
+	sess.Stdout = &stdout
+	sess.Stderr = &stderr
+
+	var mu sync.Mutex
+	var outLines, errLines *lineWriter
+	if fn != nil {
+		outLines = &lineWriter{mu: &mu, stream: Stdout, fn: fn}
+		errLines = &lineWriter{mu: &mu, stream: Stderr, fn: fn}
+		sess.Stdout = io.MultiWriter(&stdout, outLines)
+		sess.Stderr = io.MultiWriter(&stderr, errLines)
+	}
+
+	start := time.Now()
+	err = sess.Run(cmd)
+
+	if fn != nil {
+		outLines.flush()
+		errLines.flush()
+	}
+
+	res := &Result{
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
+		Duration: time.Since(start),
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		res.ExitStatus = exitErr.ExitStatus()
+		return res, &ExitError{Cmd: cmd, ExitStatus: res.ExitStatus, Stderr: res.Stderr}
+	}
+	if err != nil {
+		return res, fmt.Errorf("run command: %w", err)
+	}
+
+	return res, nil
+}
+
+// lineWriter splits output into lines and passes them to the callback.
+// Both "\n" and "\r" end a line, as progress is often redrawn with "\r".
+// Empty lines are skipped, so "\r\n" ends only one line, even when it is
+// split across writes.
+type lineWriter struct {
+	mu     *sync.Mutex
+	stream Stream
+	fn     LineFunc
+	buf    []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if i > 0 {
+			w.emit(string(w.buf[:i]))
+		}
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.emit(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *lineWriter) emit(line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.fn(w.stream, line)
+}
+
+// output runs the command and returns its stdout. Output is returned even
+// if the command fails, but may be incomplete.
+func (c *Client) output(cmd string) (string, error) {
+	res, err := c.Run(cmd)
+	if res == nil {
+		return "", err
+	}
+	return res.Stdout, err
+}
+
+// stderrContains reports whether err is an *ExitError with s in stderr.
+func stderrContains(err error, s string) bool {
+	var exitErr *ExitError
+	return errors.As(err, &exitErr) && strings.Contains(exitErr.Stderr, s)
+}
@@ -0,0 +1,40 @@
+package ssh
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   []string
+	}{
+		{"lf", []string{"one\ntwo\n"}, []string{"one", "two"}},
+		{"crlf", []string{"one\r\ntwo\r\n"}, []string{"one", "two"}},
+		{"crlf split across writes", []string{"one\r", "\ntwo\r", "\n"}, []string{"one", "two"}},
+		{"progress redrawn with cr", []string{"10%\r50%\r100%\n"}, []string{"10%", "50%", "100%"}},
+		{"empty lines", []string{"one\n\n\ntwo\n"}, []string{"one", "two"}},
+		{"unterminated last line", []string{"one\ntw", "o"}, []string{"one", "two"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			w := &lineWriter{mu: &sync.Mutex{}, stream: Stdout, fn: func(_ Stream, line string) {
+				got = append(got, line)
+			}}
+
+			for _, s := range tt.writes {
+				w.Write([]byte(s))
+			}
+			w.flush()
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got lines %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
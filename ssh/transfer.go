@@ -0,0 +1,439 @@
+package ssh
+
+import (
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// partSuffix is appended to the destination while the transfer is in
+// progress, so that an interrupted transfer never leaves a file that
+// looks complete.
+const partSuffix = ".part"
+
+// progressInterval limits how often progress is reported.
+const progressInterval = 200 * time.Millisecond
+
+// Progress describes a transfer that is in progress.
+type Progress struct {
+	Transferred int64
+	Total       int64
+
+	// Rate is the average speed in bytes per second since the transfer
+	// started, not counting resumed bytes.
+	Rate float64
+
+	// ETA is the estimated time left, or zero if it is not known yet.
+	ETA time.Duration
+}
+
+type ProgressFunc func(Progress)
+
+type TransferOptions struct {
+	// Progress is optional. It is called periodically while transferring
+	// and once more when the transfer completes.
+	Progress ProgressFunc
+
+	// Resume continues a previously interrupted transfer from where it
+	// stopped, instead of starting over.
+	Resume bool
+
+	// WrapDst is optional. Download writes data through the writer it
+	// returns, e.g. to encrypt data before it reaches the local file.
+	WrapDst func(io.Writer) (io.WriteCloser, error)
+
+	// WrapSrc is optional. Upload reads data through the reader it
+	// returns, e.g. to decrypt the local file before it is sent.
+	WrapSrc func(io.Reader) (io.Reader, error)
+}
+
+// TransferResult describes a completed transfer. Size and SHA512 are of
+// the data on the remote side, i.e. not wrapped by WrapDst or WrapSrc.
+type TransferResult struct {
+	Size     int64
+	SHA512   string
+	Duration time.Duration
+}
+
+// Download copies the remote file src to the local file dst. Data is
+// written to dst.part first, which is renamed to dst on success, and is
+// hashed while it is written, so that the file doesn't need to be read
+// again to verify it.
+func (c *Client) Download(src, dst string, opts TransferOptions) (*TransferResult, error) {
+	client, err := c.SFTP()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	srcFile, err := client.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("sftp open: %w", err)
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("sftp stat: %w", err)
+	}
+
+	// Wrapped data can't be resumed, as it doesn't map to the source
+	// byte for byte.
+	if opts.Resume && (opts.WrapDst != nil || opts.WrapSrc != nil) {
+		return nil, fmt.Errorf("wrapped transfers can't be resumed")
+	}
+
+	part := dst + partSuffix
+	hasher := sha512.New()
+
+	offset, err := resumeOffset(opts.Resume, info.Size(), func() (io.ReadCloser, error) { return os.Open(part) }, hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+		if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+			return nil, fmt.Errorf("sftp seek: %w", err)
+		}
+	}
+
+	dstFile, err := os.OpenFile(part, flags, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer dstFile.Close()
+
+	var w io.WriteCloser = dstFile
+	if opts.WrapDst != nil {
+		w, err = opts.WrapDst(dstFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t := newTransfer(offset, info.Size(), opts.Progress)
+	if _, err := io.Copy(io.MultiWriter(w, hasher, t), srcFile); err != nil {
+		return nil, fmt.Errorf("copy: %w", err)
+	}
+
+	// Wrapping writers may buffer data until they are closed.
+	if w != dstFile {
+		if err := w.Close(); err != nil {
+			return nil, fmt.Errorf("close: %w", err)
+		}
+	}
+
+	if err := dstFile.Sync(); err != nil {
+		return nil, fmt.Errorf("sync: %w", err)
+	}
+	if err := dstFile.Close(); err != nil {
+		return nil, fmt.Errorf("close: %w", err)
+	}
+
+	if err := os.Rename(part, dst); err != nil {
+		return nil, fmt.Errorf("rename: %w", err)
+	}
+
+	return t.result(hasher), nil
+}
+
+// DownloadTo copies the remote file src to w, e.g. to a pipe streaming it
+// to backup storage. Unlike Download, it can't be resumed.
+func (c *Client) DownloadTo(src string, w io.Writer, opts TransferOptions) (*TransferResult, error) {
+	if opts.Resume {
+		return nil, fmt.Errorf("streamed transfers can't be resumed")
+	}
+
+	client, err := c.SFTP()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	srcFile, err := client.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("sftp open: %w", err)
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("sftp stat: %w", err)
+	}
+
+	dst := nopCloser{w}
+	var wc io.WriteCloser = dst
+	if opts.WrapDst != nil {
+		wc, err = opts.WrapDst(w)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hasher := sha512.New()
+	t := newTransfer(0, info.Size(), opts.Progress)
+	if _, err := io.Copy(io.MultiWriter(wc, hasher, t), srcFile); err != nil {
+		return nil, fmt.Errorf("copy: %w", err)
+	}
+
+	if err := wc.Close(); err != nil {
+		return nil, fmt.Errorf("close: %w", err)
+	}
+
+	return t.result(hasher), nil
+}
+
+// nopCloser doesn't close the writer it wraps, which is owned by the
+// caller.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// Upload copies the local file src to the remote file dst. Like with
+// Download, data is written to dst.part first and renamed on success.
+func (c *Client) Upload(src, dst string, opts TransferOptions) (*TransferResult, error) {
+	client, err := c.SFTP()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer srcFile.Close()
+
+	info, err := srcFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat: %w", err)
+	}
+
+	if opts.Resume && (opts.WrapDst != nil || opts.WrapSrc != nil) {
+		return nil, fmt.Errorf("wrapped transfers can't be resumed")
+	}
+
+	part := dst + partSuffix
+	hasher := sha512.New()
+
+	// Remote part is hashed using the local file, which must have the
+	// same content up to the offset, rather than reading it back.
+	offset, err := resumeOffset(opts.Resume, info.Size(), func() (io.ReadCloser, error) {
+		remoteInfo, err := client.Stat(part)
+		if err != nil {
+			return nil, err
+		}
+		if remoteInfo.Size() > info.Size() {
+			return nil, os.ErrNotExist // start over
+		}
+		return io.NopCloser(io.LimitReader(srcFile, remoteInfo.Size())), nil
+	}, hasher)
+	if err != nil {
+		return nil, err
+	}
+
+	// Servers are not required to honour append mode, so the offset is
+	// set explicitly instead.
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY
+	}
+
+	dstFile, err := client.OpenFile(part, flags)
+	if err != nil {
+		return nil, fmt.Errorf("sftp open: %w", err)
+	}
+	defer dstFile.Close()
+
+	if _, err := dstFile.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("sftp seek: %w", err)
+	}
+	if _, err := srcFile.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek: %w", err)
+	}
+
+	var r io.Reader = srcFile
+	if opts.WrapSrc != nil {
+		r, err = opts.WrapSrc(srcFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Total is the size of the local file, so progress of wrapped uploads
+	// is approximate.
+	t := newTransfer(offset, info.Size(), opts.Progress)
+	if _, err := io.Copy(dstFile, io.TeeReader(r, io.MultiWriter(hasher, t))); err != nil {
+		return nil, fmt.Errorf("copy: %w", err)
+	}
+
+	if err := dstFile.Close(); err != nil {
+		return nil, fmt.Errorf("sftp close: %w", err)
+	}
+
+	// Plain rename fails if destination exists on most servers.
+	if err := client.PosixRename(part, dst); err != nil {
+		return nil, fmt.Errorf("sftp rename: %w", err)
+	}
+
+	return t.result(hasher), nil
+}
+
+// UploadFrom copies everything read from r to the remote file dst, e.g.
+// from backup storage. Size is only used to report progress. Like with
+// Upload, data is written to dst.part first and renamed on success.
+func (c *Client) UploadFrom(r io.Reader, size int64, dst string, opts TransferOptions) (*TransferResult, error) {
+	if opts.Resume {
+		return nil, fmt.Errorf("streamed transfers can't be resumed")
+	}
+
+	client, err := c.SFTP()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	if opts.WrapSrc != nil {
+		r, err = opts.WrapSrc(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	part := dst + partSuffix
+	dstFile, err := client.OpenFile(part, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return nil, fmt.Errorf("sftp open: %w", err)
+	}
+	defer dstFile.Close()
+
+	hasher := sha512.New()
+	t := newTransfer(0, size, opts.Progress)
+	if _, err := io.Copy(dstFile, io.TeeReader(r, io.MultiWriter(hasher, t))); err != nil {
+		return nil, fmt.Errorf("copy: %w", err)
+	}
+
+	if err := dstFile.Close(); err != nil {
+		return nil, fmt.Errorf("sftp close: %w", err)
+	}
+
+	if err := client.PosixRename(part, dst); err != nil {
+		return nil, fmt.Errorf("sftp rename: %w", err)
+	}
+
+	return t.result(hasher), nil
+}
+
+// SFTP returns a new SFTP client using the SSH connection. It must be
+// closed by the caller.
+func (c *Client) SFTP() (*sftp.Client, error) {
+	conn, err := c.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return nil, fmt.Errorf("sftp client: %w", err)
+	}
+
+	return client, nil
+}
+
+// resumeOffset returns how many bytes were transferred previously, and
+// feeds them to the hasher. Transfers start over if the partial file is
+// missing or larger than the source.
+func resumeOffset(resume bool, total int64, open func() (io.ReadCloser, error), hasher hash.Hash) (int64, error) {
+	if !resume {
+		return 0, nil
+	}
+
+	r, err := open()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("open partial file: %w", err)
+	}
+	defer r.Close()
+
+	n, err := io.Copy(hasher, r)
+	if err != nil {
+		return 0, fmt.Errorf("read partial file: %w", err)
+	}
+
+	if n > total {
+		hasher.Reset()
+		return 0, nil
+	}
+
+	return n, nil
+}
+
+// transfer counts bytes written to it and reports progress.
+type transfer struct {
+	offset      int64
+	transferred int64
+	total       int64
+	start       time.Time
+	reported    time.Time
+	fn          ProgressFunc
+}
+
+func newTransfer(offset, total int64, fn ProgressFunc) *transfer {
+	return &transfer{
+		offset:      offset,
+		transferred: offset,
+		total:       total,
+		start:       time.Now(),
+		fn:          fn,
+	}
+}
+
+func (t *transfer) Write(p []byte) (int, error) {
+	t.transferred += int64(len(p))
+
+	if now := time.Now(); now.Sub(t.reported) >= progressInterval {
+		t.report(now)
+	}
+
+	return len(p), nil
+}
+
+func (t *transfer) report(now time.Time) {
+	if t.fn == nil {
+		return
+	}
+	t.reported = now
+
+	p := Progress{Transferred: t.transferred, Total: t.total}
+
+	if elapsed := now.Sub(t.start).Seconds(); elapsed > 0 {
+		p.Rate = float64(t.transferred-t.offset) / elapsed
+	}
+	if p.Rate > 0 && t.total > t.transferred {
+		p.ETA = time.Duration(float64(t.total-t.transferred) / p.Rate * float64(time.Second))
+	}
+
+	t.fn(p)
+}
+
+func (t *transfer) result(hasher hash.Hash) *TransferResult {
+	t.report(time.Now())
+
+	return &TransferResult{
+		Size:     t.transferred,
+		SHA512:   fmt.Sprintf("%x", hasher.Sum(nil)),
+		Duration: time.Since(t.start),
+	}
+}
@@ -0,0 +1,254 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// interruptAfter is how many bytes get through before a transfer is
+// interrupted.
+const interruptAfter = 300 << 10
+
+var errInterrupted = errors.New("connection lost")
+
+// failingWriter writes up to n bytes and fails after that.
+type failingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		n, _ := f.w.Write(p[:f.n])
+		f.n -= n
+		return n, errInterrupted
+	}
+	n, err := f.w.Write(p)
+	f.n -= n
+	return n, err
+}
+
+func (f *failingWriter) Close() error { return nil }
+
+// failingReader reads up to n bytes and fails after that.
+type failingReader struct {
+	r io.Reader
+	n int
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.n == 0 {
+		return 0, errInterrupted
+	}
+	if len(p) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= n
+	return n, err
+}
+
+func newTransferClient(t *testing.T) (*Client, []byte) {
+	t.Helper()
+
+	srv := newTestServer(t)
+	c, err := New(srv.node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+
+	return c, data
+}
+
+func sha512Hex(b []byte) string {
+	return fmt.Sprintf("%x", sha512.Sum512(b))
+}
+
+func TestDownload(t *testing.T) {
+	c, data := newTransferClient(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "remote.db")
+	dst := filepath.Join(dir, "local.db")
+	if err := os.WriteFile(src, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupted download leaves the part file behind for resuming, but
+	// never the destination.
+	_, err := c.Download(src, dst, TransferOptions{
+		WrapDst: func(w io.Writer) (io.WriteCloser, error) {
+			return &failingWriter{w: w, n: interruptAfter}, nil
+		},
+	})
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("got error %v, want %v", err, errInterrupted)
+	}
+	if _, err := os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("destination exists after interrupted download: %v", err)
+	}
+	part, err := os.ReadFile(dst + partSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(part) != interruptAfter || !bytes.Equal(part, data[:interruptAfter]) {
+		t.Fatalf("part file has %d bytes, want first %d bytes of source", len(part), interruptAfter)
+	}
+
+	var progress []Progress
+	res, err := c.Download(src, dst, TransferOptions{
+		Resume:   true,
+		Progress: func(p Progress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("downloaded file doesn't match source")
+	}
+	if _, err := os.Stat(dst + partSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("part file was not renamed: %v", err)
+	}
+	if res.Size != int64(len(data)) || res.SHA512 != sha512Hex(data) {
+		t.Errorf("result is %d bytes with sha512 %.16s…, want %d bytes with %.16s…", res.Size, res.SHA512, len(data), sha512Hex(data))
+	}
+	if len(progress) == 0 || progress[len(progress)-1].Transferred != int64(len(data)) {
+		t.Errorf("progress doesn't end with the whole file: %+v", progress)
+	}
+}
+
+func TestDownloadResume(t *testing.T) {
+	c, data := newTransferClient(t)
+
+	// Part file differs from the source, so that it is possible to tell
+	// which bytes were downloaded again.
+	stale := bytes.Repeat([]byte{'x'}, interruptAfter)
+	resumed := append(bytes.Clone(stale), data[interruptAfter:]...)
+
+	tests := []struct {
+		name   string
+		part   []byte
+		resume bool
+		want   []byte
+	}{
+		{"resumes from part file", stale, true, resumed},
+		{"starts over without resume", stale, false, data},
+		{"starts over if part file is larger", append(bytes.Clone(data), 'x'), true, data},
+		{"starts without part file", nil, true, data},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, "remote.db")
+			dst := filepath.Join(dir, "local.db")
+			if err := os.WriteFile(src, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.part != nil {
+				if err := os.WriteFile(dst+partSuffix, tt.part, 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			res, err := c.Download(src, dst, TransferOptions{Resume: tt.resume})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Error("downloaded file doesn't have the expected content")
+			}
+			// Hash covers resumed bytes, so it describes the whole file.
+			if res.SHA512 != sha512Hex(tt.want) {
+				t.Error("sha512 doesn't match downloaded file")
+			}
+		})
+	}
+}
+
+func TestUpload(t *testing.T) {
+	c, data := newTransferClient(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "local.db")
+	dst := filepath.Join(dir, "remote.db")
+	if err := os.WriteFile(src, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.Upload(src, dst, TransferOptions{
+		WrapSrc: func(r io.Reader) (io.Reader, error) {
+			return &failingReader{r: r, n: interruptAfter}, nil
+		},
+	})
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("got error %v, want %v", err, errInterrupted)
+	}
+	if _, err := os.Stat(dst); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("destination exists after interrupted upload: %v", err)
+	}
+
+	res, err := c.Upload(src, dst, TransferOptions{Resume: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("uploaded file doesn't match source")
+	}
+	if res.SHA512 != sha512Hex(data) {
+		t.Error("sha512 doesn't match source")
+	}
+}
+
+func TestUploadResume(t *testing.T) {
+	c, data := newTransferClient(t)
+	dir := t.TempDir()
+	src := filepath.Join(dir, "local.db")
+	dst := filepath.Join(dir, "remote.db")
+	if err := os.WriteFile(src, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remote part file differs from the source, so that it is possible to
+	// tell that its bytes were not sent again.
+	stale := bytes.Repeat([]byte{'x'}, interruptAfter)
+	if err := os.WriteFile(dst+partSuffix, stale, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Upload(src, dst, TransferOptions{Resume: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got[:interruptAfter], stale) || !bytes.Equal(got[interruptAfter:], data[interruptAfter:]) {
+		t.Error("upload didn't continue from the end of the part file")
+	}
+}
@@ -0,0 +1,127 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+type CephUpgradeCheck struct {
+	TargetName  string         `json:"target_name"`
+	TargetID    string         `json:"target_id"`
+	NeedsUpdate map[string]any `json:"needs_update"`
+	UpToDate    []string       `json:"up_to_date"`
+}
+
+type CephUpgradeStatus struct {
+	TargetImage      string   `json:"target_image"`
+	InProgress       bool     `json:"in_progress"`
+	Which            string   `json:"which"`
+	ServicesComplete []string `json:"services_complete"`
+	Progress         string   `json:"progress"`
+	Message          string   `json:"message"`
+	IsPaused         bool     `json:"is_paused"`
+}
+
+// CephVersions maps daemon types to the number of daemons running each
+// version, e.g. {"mon": {"19.2.2": 3}}.
+type CephVersions map[string]map[string]int
+
+// CephUpgradeCheck verifies that the container image for the version
+// exists and returns daemons that would be upgraded.
+func (c *Client) CephUpgradeCheck(version string) (*CephUpgradeCheck, error) {
+	if err := config.ValidateCephRelease(version); err != nil {
+		return nil, err
+	}
+
+	out, err := c.output(sudo("ceph", "orch", "upgrade", "check", "--ceph-version", version))
+	if err != nil {
+		return nil, fmt.Errorf("ceph orch upgrade check: %w", err)
+	}
+
+	var check CephUpgradeCheck
+	if err := json.Unmarshal([]byte(out), &check); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return &check, nil
+}
+
+func (c *Client) CephUpgradeStart(version string) error {
+	if err := config.ValidateCephRelease(version); err != nil {
+		return err
+	}
+
+	if _, err := c.output(sudo("ceph", "orch", "upgrade", "start", "--ceph-version", version)); err != nil {
+		return fmt.Errorf("ceph orch upgrade start: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) CephUpgradeStatus() (*CephUpgradeStatus, error) {
+	out, err := c.output(sudo("ceph", "orch", "upgrade", "status", "--format", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("ceph orch upgrade status: %w", err)
+	}
+
+	var status CephUpgradeStatus
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return &status, nil
+}
+
+func (c *Client) CephUpgradePause() error {
+	if _, err := c.output(sudo("ceph", "orch", "upgrade", "pause")); err != nil {
+		return fmt.Errorf("ceph orch upgrade pause: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) CephUpgradeResume() error {
+	if _, err := c.output(sudo("ceph", "orch", "upgrade", "resume")); err != nil {
+		return fmt.Errorf("ceph orch upgrade resume: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) CephUpgradeStop() error {
+	if _, err := c.output(sudo("ceph", "orch", "upgrade", "stop")); err != nil {
+		return fmt.Errorf("ceph orch upgrade stop: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) CephVersions() (CephVersions, error) {
+	out, err := c.output(sudo("ceph", "versions", "-f", "json"))
+	if err != nil {
+		return nil, fmt.Errorf("ceph versions: %w", err)
+	}
+
+	var raw map[string]map[string]int
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	// Version strings look like "ceph version 19.2.2 (<sha>) squid (stable)",
+	// but only the version number is interesting.
+	versions := make(CephVersions, len(raw))
+	for daemonType, counts := range raw {
+		if daemonType == "overall" {
+			continue
+		}
+		versions[daemonType] = make(map[string]int, len(counts))
+		for s, n := range counts {
+			version := s
+			if fields := strings.Fields(s); len(fields) > 2 {
+				version = fields[2]
+			}
+			versions[daemonType][version] += n
+		}
+	}
+
+	return versions, nil
+}
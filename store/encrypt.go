@@ -0,0 +1,89 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+)
+
+const (
+	// EncryptionAge is recorded in manifests of snapshots encrypted to
+	// age recipients.
+	EncryptionAge = "age"
+
+	// EncryptionPassphrase is recorded in manifests of snapshots encrypted
+	// with a passphrase.
+	EncryptionPassphrase = "passphrase"
+
+	// EncryptedExt is appended to names of encrypted snapshots.
+	EncryptedExt = ".age"
+)
+
+// ParseRecipients parses age recipients, e.g. "age1...", or SSH public
+// keys, e.g. "ssh-ed25519 AAAA...".
+func ParseRecipients(keys []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, key := range keys {
+		var r age.Recipient
+		var err error
+		if strings.HasPrefix(key, "age1") {
+			r, err = age.ParseX25519Recipient(key)
+		} else {
+			r, err = agessh.ParseRecipient(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse recipient %q: %w", key, err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// ParseIdentityFile reads age identities, as written by age-keygen, or an
+// unencrypted SSH private key from filename.
+func ParseIdentityFile(filename string) ([]age.Identity, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(string(b)))
+	if err == nil {
+		return identities, nil
+	}
+
+	identity, sshErr := agessh.ParseIdentity(b)
+	if sshErr != nil {
+		return nil, fmt.Errorf("parse identity file %s: %w", filename, err)
+	}
+
+	return []age.Identity{identity}, nil
+}
+
+// PassphraseEncrypted reports whether the age encrypted data was encrypted
+// with a passphrase, rather than to recipients. Only the header is read.
+func PassphraseEncrypted(r io.Reader) (bool, error) {
+	// Header is a version line followed by one "-> type args" line per
+	// recipient and ends with a "---" line.
+	scanner := bufio.NewScanner(io.LimitReader(r, 64*1024))
+	if !scanner.Scan() || scanner.Text() != "age-encryption.org/v1" {
+		return false, fmt.Errorf("not an age encrypted file")
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "---") {
+			break
+		}
+		if strings.HasPrefix(line, "-> scrypt ") {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// partSuffix is appended to files while they are written.
+const partSuffix = ".part"
+
+// Local stores files in a local directory.
+type Local struct {
+	dir string
+}
+
+// NewLocal returns storage for the directory, which is created if it
+// doesn't exist.
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create backup directory: %w", err)
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (l *Local) Put(name string, r io.Reader) error {
+	filename := filepath.Join(l.dir, name)
+
+	// Backups may contain secrets, so they are only readable by the owner.
+	f, err := os.OpenFile(filename+partSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filename)
+}
+
+func (l *Local) Get(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(l.dir, name))
+}
+
+func (l *Local) Size(name string) (int64, error) {
+	info, err := os.Stat(filepath.Join(l.dir, name))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (l *Local) List() ([]string, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+func (l *Local) Remove(name string) error {
+	err := os.Remove(filepath.Join(l.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l *Local) String() string {
+	return l.dir
+}
+
+func (l *Local) Close() error {
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package store manages etcd snapshots kept in backup storage, which is a
+// local directory, an S3 bucket or a directory on an SFTP server. Every
+// snapshot has a JSON manifest next to it, which describes the snapshot
+// and is used to verify it later.
+package store
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+)
+
+// ManifestExt is appended to the snapshot file name to get the name of
+// its manifest.
+const ManifestExt = ".json"
+
+type Manifest struct {
+	// Filename is the name of the snapshot file in the backup directory.
+	Filename string `json:"filename"`
+
+	Cluster  string    `json:"cluster"`
+	Created  time.Time `json:"created"`
+	Member   string    `json:"member"`
+	Revision int64     `json:"revision"`
+
+	// SHA512 and Size are of the snapshot after compression, but before
+	// encryption, i.e. as it was on the control plane node.
+	SHA512 string `json:"sha512"`
+	Size   int64  `json:"size"`
+
+	// Compression is "zstd" for compressed snapshots, empty otherwise.
+	Compression string `json:"compression,omitempty"`
+
+	// Encryption is EncryptionAge or EncryptionPassphrase for encrypted
+	// snapshots, empty otherwise.
+	Encryption string `json:"encryption,omitempty"`
+}
+
+// Name returns the file name for a snapshot of the cluster taken at t,
+// e.g. "etcd-lab-20260102T150405Z.db.zst.age".
+func Name(cluster string, t time.Time, compression, encryption string) string {
+	name := fmt.Sprintf("etcd-%s-%s.db", cluster, t.UTC().Format("20060102T150405Z"))
+	if compression == "zstd" {
+		name += ".zst"
+	}
+	if encryption != "" {
+		name += EncryptedExt
+	}
+	return name
+}
+
+// WriteManifest stores the manifest next to the snapshot.
+func WriteManifest(st Storage, m *Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("json: %w", err)
+	}
+
+	return st.Put(m.Filename+ManifestExt, bytes.NewReader(append(b, '\n')))
+}
+
+// List returns manifests of all snapshots in storage, newest first.
+func List(st Storage) ([]Manifest, error) {
+	names, err := st.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var manifests []Manifest
+	for _, name := range names {
+		if !strings.HasSuffix(name, ManifestExt) {
+			continue
+		}
+
+		m, err := readManifest(st, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		manifests = append(manifests, *m)
+	}
+
+	slices.SortFunc(manifests, func(a, b Manifest) int {
+		return b.Created.Compare(a.Created)
+	})
+
+	return manifests, nil
+}
+
+func readManifest(st Storage, name string) (*Manifest, error) {
+	r, err := st.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+// Verify checks that the snapshot in storage matches its manifest.
+// Encrypted snapshots are decrypted with the identities while they are
+// read.
+func Verify(st Storage, m Manifest, identities ...age.Identity) error {
+	f, err := st.Get(m.Filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if m.Encryption != "" {
+		r, err = age.Decrypt(f, identities...)
+		if err != nil {
+			return fmt.Errorf("decrypt: %w", err)
+		}
+	}
+
+	h := sha512.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return err
+	}
+
+	if n != m.Size {
+		return fmt.Errorf("size is %d bytes, expected %d", n, m.Size)
+	}
+	if sum := fmt.Sprintf("%x", h.Sum(nil)); sum != m.SHA512 {
+		return fmt.Errorf("sha512 hashes are not matching")
+	}
+
+	return nil
+}
+
+// Remove deletes the snapshot and its manifest from storage.
+func Remove(st Storage, m Manifest) error {
+	if err := st.Remove(m.Filename); err != nil {
+		return err
+	}
+	return st.Remove(m.Filename + ManifestExt)
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func TestVerify(t *testing.T) {
+	data := []byte("etcd snapshot")
+	sum := fmt.Sprintf("%x", sha512.Sum512(data))
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+
+	tests := []struct {
+		name       string
+		stored     []byte
+		manifest   Manifest
+		identities []age.Identity
+		wantErr    bool
+	}{
+		{
+			name:     "plain",
+			stored:   data,
+			manifest: Manifest{SHA512: sum, Size: int64(len(data))},
+		},
+		{
+			name:     "wrong size",
+			stored:   data,
+			manifest: Manifest{SHA512: sum, Size: int64(len(data)) + 1},
+			wantErr:  true,
+		},
+		{
+			name:     "wrong sha512",
+			stored:   append(slices.Clone(data[:len(data)-1]), 'X'),
+			manifest: Manifest{SHA512: sum, Size: int64(len(data))},
+			wantErr:  true,
+		},
+		{
+			name:       "encrypted",
+			stored:     encrypted.Bytes(),
+			manifest:   Manifest{SHA512: sum, Size: int64(len(data)), Encryption: EncryptionAge},
+			identities: []age.Identity{other, identity},
+		},
+		{
+			name:       "wrong identity",
+			stored:     encrypted.Bytes(),
+			manifest:   Manifest{SHA512: sum, Size: int64(len(data)), Encryption: EncryptionAge},
+			identities: []age.Identity{other},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := NewLocal(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.manifest.Filename = "snapshot.db"
+			if err := st.Put(tt.manifest.Filename, bytes.NewReader(tt.stored)); err != nil {
+				t.Fatal(err)
+			}
+
+			err = Verify(st, tt.manifest, tt.identities...)
+			if tt.wantErr && err == nil {
+				t.Error("expected error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestManifests(t *testing.T) {
+	st, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+	for i := range 3 {
+		m := &Manifest{
+			Filename: Name("lab", created.Add(time.Duration(i)*time.Hour), "zstd", ""),
+			Cluster:  "lab",
+			Created:  created.Add(time.Duration(i) * time.Hour),
+		}
+		if err := st.Put(m.Filename, bytes.NewReader(nil)); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteManifest(st, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifests, err := List(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"etcd-lab-20260102T170405Z.db.zst",
+		"etcd-lab-20260102T160405Z.db.zst",
+		"etcd-lab-20260102T150405Z.db.zst",
+	}
+	if got := filenames(manifests); !slices.Equal(got, want) {
+		t.Fatalf("listed %q, want %q", got, want)
+	}
+
+	if err := Remove(st, manifests[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	files := listFiles(t, st)
+	if slices.Contains(files, want[0]) || slices.Contains(files, want[0]+ManifestExt) {
+		t.Errorf("%s or its manifest was not removed: %q", want[0], files)
+	}
+	if len(files) != 4 {
+		t.Errorf("files are %q, want 2 snapshots with manifests", files)
+	}
+}
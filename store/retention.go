@@ -0,0 +1,78 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retention describes how many snapshots to keep in grandfather-father-son
+// fashion. Newest snapshot in each of the last Hourly hours, Daily days and
+// Weekly weeks is kept. Zero value keeps all snapshots.
+type Retention struct {
+	Hourly int
+	Daily  int
+	Weekly int
+}
+
+// Enabled reports whether any retention rule is set.
+func (r Retention) Enabled() bool {
+	return r.Hourly > 0 || r.Daily > 0 || r.Weekly > 0
+}
+
+// Apply splits manifests, which must be sorted newest first, into the ones
+// to keep and the ones to remove.
+func (r Retention) Apply(manifests []Manifest) (keep, remove []Manifest) {
+	if !r.Enabled() {
+		return manifests, nil
+	}
+
+	rules := []*rule{
+		{count: r.Hourly, bucket: func(t time.Time) string { return t.Format("2006-01-02T15") }},
+		{count: r.Daily, bucket: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{count: r.Weekly, bucket: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}},
+	}
+
+	for _, m := range manifests {
+		kept := false
+		for _, rule := range rules {
+			if rule.keep(m.Created.Local()) {
+				kept = true
+			}
+		}
+
+		if kept {
+			keep = append(keep, m)
+		} else {
+			remove = append(remove, m)
+		}
+	}
+
+	return keep, remove
+}
+
+// rule keeps the newest snapshot in each of the last count buckets.
+type rule struct {
+	count  int
+	bucket func(time.Time) string
+	last   string
+	kept   int
+}
+
+func (r *rule) keep(t time.Time) bool {
+	if r.kept >= r.count {
+		return false
+	}
+
+	b := r.bucket(t)
+	if b == r.last {
+		return false
+	}
+
+	r.last = b
+	r.kept++
+
+	return true
+}
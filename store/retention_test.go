@@ -0,0 +1,89 @@
+package store
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRetentionApply(t *testing.T) {
+	at := func(month time.Month, day, hour, min int) Manifest {
+		created := time.Date(2026, month, day, hour, min, 0, 0, time.Local)
+		return Manifest{Filename: created.Format("01-02T15:04"), Created: created}
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		manifests []Manifest
+		keep      []string
+	}{
+		{
+			name:      "disabled",
+			retention: Retention{},
+			manifests: []Manifest{at(1, 3, 10, 30), at(1, 3, 10, 0), at(1, 1, 8, 0)},
+			keep:      []string{"01-03T10:30", "01-03T10:00", "01-01T08:00"},
+		},
+		{
+			name:      "hourly",
+			retention: Retention{Hourly: 2},
+			manifests: []Manifest{at(1, 3, 10, 30), at(1, 3, 10, 0), at(1, 3, 9, 30), at(1, 3, 8, 0)},
+			keep:      []string{"01-03T10:30", "01-03T09:30"},
+		},
+		{
+			name:      "daily",
+			retention: Retention{Daily: 2},
+			manifests: []Manifest{at(1, 3, 12, 0), at(1, 3, 8, 0), at(1, 2, 20, 0), at(1, 1, 10, 0)},
+			keep:      []string{"01-03T12:00", "01-02T20:00"},
+		},
+		{
+			// 2026-01-12 and 2026-01-14 are in ISO week 3, 2026-01-08 in
+			// week 2 and 2026-01-01 in week 1.
+			name:      "weekly",
+			retention: Retention{Weekly: 2},
+			manifests: []Manifest{at(1, 14, 9, 0), at(1, 12, 9, 0), at(1, 8, 9, 0), at(1, 1, 9, 0)},
+			keep:      []string{"01-14T09:00", "01-08T09:00"},
+		},
+		{
+			// Snapshots kept by one rule count towards the others too.
+			name:      "combined",
+			retention: Retention{Hourly: 1, Daily: 2, Weekly: 3},
+			manifests: []Manifest{at(1, 14, 12, 0), at(1, 14, 11, 0), at(1, 13, 9, 0), at(1, 12, 9, 0), at(1, 8, 9, 0), at(1, 1, 9, 0)},
+			keep:      []string{"01-14T12:00", "01-13T09:00", "01-08T09:00", "01-01T09:00"},
+		},
+		{
+			name:      "fewer than retained",
+			retention: Retention{Hourly: 24, Daily: 7},
+			manifests: []Manifest{at(1, 3, 10, 0), at(1, 2, 10, 0)},
+			keep:      []string{"01-03T10:00", "01-02T10:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep, remove := tt.retention.Apply(tt.manifests)
+
+			if got := filenames(keep); !slices.Equal(got, tt.keep) {
+				t.Errorf("kept %q, want %q", got, tt.keep)
+			}
+
+			// Every manifest is either kept or removed.
+			if len(keep)+len(remove) != len(tt.manifests) {
+				t.Errorf("kept %d and removed %d of %d", len(keep), len(remove), len(tt.manifests))
+			}
+			for _, m := range remove {
+				if slices.Contains(tt.keep, m.Filename) {
+					t.Errorf("removed %s", m.Filename)
+				}
+			}
+		})
+	}
+}
+
+func filenames(manifests []Manifest) []string {
+	var names []string
+	for _, m := range manifests {
+		names = append(names, m.Filename)
+	}
+	return names
+}
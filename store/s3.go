@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// s3PartSize is the size of multipart upload parts. Snapshots are streamed,
+// so their size is not known up front, and each part is buffered in memory.
+const s3PartSize = 16 << 20
+
+// S3 stores files in a bucket of S3-compatible storage, e.g. MinIO.
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3 returns storage for files under the prefix in the bucket.
+func NewS3(bucket, prefix string, cfg *config.S3) (*S3, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 url must include a bucket, e.g. s3://bucket/prefix")
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint == "" {
+		endpoint = "https://s3.amazonaws.com"
+	}
+
+	// Endpoint without a scheme is assumed to use TLS.
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse s3 endpoint: %w", err)
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{},
+	})
+	if cfg.AccessKey != "" {
+		creds = credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, "")
+	}
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  creds,
+		Secure: u.Scheme == "https",
+		Region: region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("s3 client: %w", err)
+	}
+
+	return &S3{client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *S3) key(name string) string {
+	return path.Join(s.prefix, name)
+}
+
+func (s *S3) Put(name string, r io.Reader) error {
+	// Multipart upload is only completed once r is fully read, otherwise
+	// it is aborted and the object is not created. Server checks every
+	// part against its MD5.
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.key(name), r, -1, minio.PutObjectOptions{
+		PartSize:       s3PartSize,
+		SendContentMd5: true,
+	})
+	if err != nil {
+		return fmt.Errorf("s3 put %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *S3) Get(name string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, s.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("s3 get %s: %w", name, err)
+	}
+
+	// Errors, e.g. missing objects, are only returned once the object is
+	// accessed.
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("s3 get %s: %w", name, err)
+	}
+
+	return obj, nil
+}
+
+func (s *S3) Size(name string) (int64, error) {
+	info, err := s.client.StatObject(context.Background(), s.bucket, s.key(name), minio.StatObjectOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("s3 stat %s: %w", name, err)
+	}
+	return info.Size, nil
+}
+
+func (s *S3) List() ([]string, error) {
+	prefix := s.prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var names []string
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("s3 list: %w", obj.Err)
+		}
+		// Objects in "subdirectories" are not listed, same as with
+		// local storage.
+		name := strings.TrimPrefix(obj.Key, prefix)
+		if name != "" && !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (s *S3) Remove(name string) error {
+	if err := s.client.RemoveObject(context.Background(), s.bucket, s.key(name), minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("s3 remove %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *S3) String() string {
+	return "s3://" + path.Join(s.bucket, s.prefix)
+}
+
+func (s *S3) Close() error {
+	return nil
+}
@@ -0,0 +1,330 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// fakeS3 is a stand-in for S3-compatible storage, e.g. MinIO. It only
+// implements requests made by S3 storage, with path-style addressing and
+// without checking signatures.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	nextID  int
+}
+
+// fakeS3Modified is reported as modification time of every object.
+var fakeS3Modified = time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	t.Helper()
+
+	f := &fakeS3{
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+
+	return f, srv
+}
+
+func newTestS3(t *testing.T, bucket, prefix string) (*S3, *fakeS3) {
+	t.Helper()
+
+	f, srv := newFakeS3(t)
+
+	s, err := NewS3(bucket, prefix, &config.S3{
+		Endpoint:  srv.URL,
+		Region:    "us-east-1",
+		AccessKey: "labctl",
+		SecretKey: "labctl-secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, f
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.list(w, bucket, query.Get("prefix"))
+
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = make(map[int][]byte)
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[n] = body
+		w.Header().Set("ETag", etag(body))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		id := query.Get("uploadId")
+		parts, ok := f.uploads[id]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&complete); err != nil {
+			s3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var object []byte
+		for _, p := range complete.Parts {
+			object = append(object, parts[p.PartNumber]...)
+		}
+		delete(f.uploads, id)
+		f.objects[bucket+"/"+key] = object
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: bucket, Key: key, ETag: etag(object)})
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		f.objects[bucket+"/"+key] = body
+		w.Header().Set("ETag", etag(body))
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := f.objects[bucket+"/"+key]
+		if !ok {
+			s3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", etag(object))
+		http.ServeContent(w, r, key, fakeS3Modified, bytes.NewReader(object))
+
+	case r.Method == http.MethodDelete:
+		delete(f.objects, bucket+"/"+key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket, prefix string) {
+	type object struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+	}
+
+	var contents []object
+	for k, v := range f.objects {
+		if key, ok := strings.CutPrefix(k, bucket+"/"); ok && strings.HasPrefix(key, prefix) {
+			contents = append(contents, object{
+				Key:          key,
+				LastModified: fakeS3Modified.Format(time.RFC3339),
+				ETag:         etag(v),
+				Size:         len(v),
+			})
+		}
+	}
+	slices.SortFunc(contents, func(a, b object) int { return strings.Compare(a.Key, b.Key) })
+
+	writeXML(w, struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []object
+	}{Name: bucket, Prefix: prefix, KeyCount: len(contents), MaxKeys: 1000, Contents: contents})
+}
+
+// objectNames returns keys of all stored objects.
+func (f *fakeS3) objectNames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+	for k := range f.objects {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// multipartUploads returns the number of multipart uploads that were started, and
+// the number of them that are neither completed nor aborted.
+func (f *fakeS3) multipartUploads() (started, pending int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.nextID, len(f.uploads)
+}
+
+// readBody reads the request body, decoding chunks of streaming uploads,
+// and checks it against Content-Md5 if it is set.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	var body []byte
+	var err error
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body, err = readChunked(r.Body)
+	} else {
+		body, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		s3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return nil, false
+	}
+
+	if want := r.Header.Get("Content-Md5"); want != "" {
+		sum := md5.Sum(body)
+		if base64.StdEncoding.EncodeToString(sum[:]) != want {
+			s3Error(w, http.StatusBadRequest, "BadDigest")
+			return nil, false
+		}
+	}
+
+	return body, true
+}
+
+// readChunked decodes aws-chunked encoding, where every chunk is preceded
+// by "<hex size>;chunk-signature=<signature>\r\n" and followed by "\r\n".
+func readChunked(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+
+	var body []byte
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("chunk size: %w", err)
+		}
+		if n == 0 {
+			return body, nil
+		}
+
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		body = append(body, chunk[:n]...)
+	}
+}
+
+func etag(b []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(b))
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func s3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: code})
+}
+
+func TestS3Prefix(t *testing.T) {
+	s, f := newTestS3(t, "backups", "etcd/lab")
+
+	if err := s.Put("snapshot.db", strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := f.objectNames(), []string{"backups/etcd/lab/snapshot.db"}; !slices.Equal(got, want) {
+		t.Errorf("objects are %q, want %q", got, want)
+	}
+	if got, want := s.String(), "s3://backups/etcd/lab"; got != want {
+		t.Errorf("location is %q, want %q", got, want)
+	}
+}
+
+func TestS3AbortedMultipartPut(t *testing.T) {
+	s, f := newTestS3(t, "backups", "")
+
+	// Failing after the first part has been uploaded starts a multipart
+	// upload, which must be aborted.
+	_, err := Write(s, "snapshot.db", func(w io.Writer) error {
+		if _, err := w.Write(make([]byte, s3PartSize+1)); err != nil {
+			return err
+		}
+		return fmt.Errorf("snapshot failed")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if names := f.objectNames(); len(names) > 0 {
+		t.Errorf("objects %q were left behind", names)
+	}
+	started, pending := f.multipartUploads()
+	if started == 0 {
+		t.Error("multipart upload was not started")
+	}
+	if pending > 0 {
+		t.Errorf("%d multipart uploads were left behind", pending)
+	}
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/sftp"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/ssh"
+)
+
+// SFTP stores files in a directory on an SFTP server, e.g. a NAS.
+type SFTP struct {
+	client *sftp.Client
+	host   string
+	dir    string
+}
+
+// NewSFTP returns storage for sftp://[user@]host[:port]/path URL. Host is
+// either a node from the configuration file or a host to connect to.
+// Paths starting with /~/ are relative to the home directory.
+func NewSFTP(u *url.URL, cfg *config.Config) (*SFTP, error) {
+	spec := u.Host
+	if u.User != nil {
+		spec = u.User.Username() + "@" + spec
+	}
+
+	node, err := cfg.ResolveNode(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	sshClient, err := ssh.Get(node)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: %w", err)
+	}
+
+	client, err := sshClient.SFTP()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := u.Path
+	if rel, ok := strings.CutPrefix(dir, "/~/"); ok {
+		dir = rel
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	if err := client.MkdirAll(dir); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("sftp create backup directory: %w", err)
+	}
+
+	return &SFTP{client: client, host: spec, dir: dir}, nil
+}
+
+func (s *SFTP) Put(name string, r io.Reader) error {
+	filename := path.Join(s.dir, name)
+
+	f, err := s.client.OpenFile(filename+partSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("sftp open: %w", err)
+	}
+	defer f.Close()
+
+	// Backups may contain secrets, so they are only readable by the owner.
+	if err := f.Chmod(0o600); err != nil {
+		s.client.Remove(f.Name())
+		return fmt.Errorf("sftp chmod: %w", err)
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		s.client.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		s.client.Remove(f.Name())
+		return fmt.Errorf("sftp close: %w", err)
+	}
+
+	// Plain rename fails if destination exists on most servers.
+	if err := s.client.PosixRename(f.Name(), filename); err != nil {
+		s.client.Remove(f.Name())
+		return fmt.Errorf("sftp rename: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SFTP) Get(name string) (io.ReadCloser, error) {
+	f, err := s.client.Open(path.Join(s.dir, name))
+	if err != nil {
+		return nil, fmt.Errorf("sftp open: %w", err)
+	}
+	return f, nil
+}
+
+func (s *SFTP) Size(name string) (int64, error) {
+	info, err := s.client.Stat(path.Join(s.dir, name))
+	if err != nil {
+		return 0, fmt.Errorf("sftp stat: %w", err)
+	}
+	return info.Size(), nil
+}
+
+func (s *SFTP) List() ([]string, error) {
+	infos, err := s.client.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("sftp list: %w", err)
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *SFTP) Remove(name string) error {
+	err := s.client.Remove(path.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sftp remove: %w", err)
+	}
+	return nil
+}
+
+func (s *SFTP) String() string {
+	if path.IsAbs(s.dir) {
+		return "sftp://" + s.host + s.dir
+	}
+	return "sftp://" + s.host + "/~/" + s.dir
+}
+
+func (s *SFTP) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,125 @@
+package store
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/romantomjak/labctl/config"
+)
+
+// Storage is where backups are kept, e.g. a local directory, an S3 bucket
+// or a directory on an SFTP server.
+type Storage interface {
+	// Put stores everything read from r as the named file. The file only
+	// appears once r returns io.EOF, so a failed upload never leaves a
+	// file that looks complete.
+	Put(name string, r io.Reader) error
+
+	// Get returns contents of the named file.
+	Get(name string) (io.ReadCloser, error)
+
+	// Size returns size of the named file in bytes.
+	Size(name string) (int64, error)
+
+	// List returns names of all files.
+	List() ([]string, error)
+
+	// Remove deletes the named file.
+	Remove(name string) error
+
+	// String returns location of the storage, e.g. "s3://bucket/prefix".
+	String() string
+
+	Close() error
+}
+
+// New returns storage for the location, which is either a local directory
+// or a URL with file, s3 or sftp scheme.
+func New(location string, cfg *config.Config) (Storage, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" || filepath.VolumeName(location) != "" {
+		return NewLocal(location)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return NewLocal(u.Path)
+	case "s3":
+		return NewS3(u.Host, strings.Trim(u.Path, "/"), cfg.S3)
+	case "sftp":
+		return NewSFTP(u, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported storage %q, expected a directory, s3:// or sftp:// URL", location)
+	}
+}
+
+// Locate returns storage for the directory of the file, which is either a
+// local path or a URL, and name of the file in it.
+func Locate(file string, cfg *config.Config) (Storage, string, error) {
+	dir, name := path.Split(file)
+	if name == "" {
+		return nil, "", fmt.Errorf("%s is not a file", file)
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	st, err := New(dir, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return st, name, nil
+}
+
+// Location returns location of the named file in storage, for messages.
+func Location(st Storage, name string) string {
+	if _, ok := st.(*Local); ok {
+		return filepath.Join(st.String(), name)
+	}
+	return st.String() + "/" + name
+}
+
+// Write stores everything fn writes as the named file, and returns SHA-512
+// of the stored data.
+func Write(st Storage, name string, fn func(w io.Writer) error) (string, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(fn(pw))
+	}()
+
+	hasher := sha512.New()
+	if err := st.Put(name, io.TeeReader(pr, hasher)); err != nil {
+		// Unblock fn if storage stopped reading early.
+		pr.CloseWithError(err)
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+// Check reads the named file back from storage and checks that it has
+// the SHA-512 returned by Write.
+func Check(st Storage, name, sha512sum string) error {
+	r, err := st.Get(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	hasher := sha512.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+
+	if sum := fmt.Sprintf("%x", hasher.Sum(nil)); sum != sha512sum {
+		return fmt.Errorf("sha512 of stored %s is not matching", name)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// storages returns every kind of storage, backed by a temporary
+// directory or a stand-in server.
+func storages(t *testing.T) map[string]Storage {
+	t.Helper()
+
+	local, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s3, _ := newTestS3(t, "backups", "etcd")
+
+	return map[string]Storage{
+		"local": local,
+		"s3":    s3,
+		"sftp":  newTestSFTP(t),
+	}
+}
+
+// newTestSFTP returns SFTP storage talking to an in-process SFTP server,
+// which serves a temporary directory.
+func newTestSFTP(t *testing.T) *SFTP {
+	t.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverR, serverW})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(clientR, clientW)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &SFTP{client: client, host: "test", dir: t.TempDir()}
+	t.Cleanup(func() {
+		// Client waits for the server to hang up.
+		server.Close()
+		s.Close()
+	})
+
+	return s
+}
+
+func TestStorage(t *testing.T) {
+	for name, st := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := st.Put("a.db", strings.NewReader("first")); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Put("b.db", strings.NewReader("second")); err != nil {
+				t.Fatal(err)
+			}
+
+			// Existing files are replaced.
+			if err := st.Put("a.db", strings.NewReader("replaced")); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := readFile(t, st, "a.db"); got != "replaced" {
+				t.Errorf("a.db contains %q, want %q", got, "replaced")
+			}
+
+			size, err := st.Size("b.db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != int64(len("second")) {
+				t.Errorf("b.db is %d bytes, want %d", size, len("second"))
+			}
+
+			if got, want := listFiles(t, st), []string{"a.db", "b.db"}; !slices.Equal(got, want) {
+				t.Errorf("files are %q, want %q", got, want)
+			}
+
+			if err := st.Remove("a.db"); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.Remove("missing.db"); err != nil {
+				t.Errorf("removing missing file: %v", err)
+			}
+
+			if got, want := listFiles(t, st), []string{"b.db"}; !slices.Equal(got, want) {
+				t.Errorf("files are %q, want %q", got, want)
+			}
+
+			if _, err := st.Get("a.db"); err == nil {
+				t.Error("expected error getting removed file")
+			}
+			if _, err := st.Size("a.db"); err == nil {
+				t.Error("expected error getting size of removed file")
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for name, st := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+			data := bytes.Repeat([]byte("etcd"), 1024)
+
+			sum, err := Write(st, "snapshot.db", func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want := fmt.Sprintf("%x", sha512.Sum512(data)); sum != want {
+				t.Errorf("sha512 is %s, want %s", sum, want)
+			}
+			if err := Check(st, "snapshot.db", sum); err != nil {
+				t.Error(err)
+			}
+			if err := Check(st, "snapshot.db", strings.Repeat("0", 128)); err == nil {
+				t.Error("expected error checking wrong sha512")
+			}
+		})
+	}
+}
+
+func TestWriteAborted(t *testing.T) {
+	for name, st := range storages(t) {
+		t.Run(name, func(t *testing.T) {
+			_, err := Write(st, "snapshot.db", func(w io.Writer) error {
+				if _, err := w.Write([]byte("partial")); err != nil {
+					return err
+				}
+				return fmt.Errorf("snapshot failed")
+			})
+			if err == nil || !strings.Contains(err.Error(), "snapshot failed") {
+				t.Fatalf("expected snapshot error, got %v", err)
+			}
+
+			if files := listFiles(t, st); len(files) > 0 {
+				t.Errorf("files %q were left behind", files)
+			}
+		})
+	}
+}
+
+func TestSFTPPutRenameFailed(t *testing.T) {
+	st := newTestSFTP(t)
+
+	// Directory in place of the file can't be replaced.
+	if err := st.client.MkdirAll(path.Join(st.dir, "snapshot.db", "keep")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Put("snapshot.db", strings.NewReader("etcd")); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if files := listFiles(t, st); len(files) > 0 {
+		t.Errorf("files %q were left behind", files)
+	}
+}
+
+func readFile(t *testing.T, st Storage, name string) string {
+	t.Helper()
+
+	r, err := st.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(b)
+}
+
+func listFiles(t *testing.T, st Storage) []string {
+	t.Helper()
+
+	names, err := st.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,97 @@
+// Package wait implements polling with exponential backoff.
+package wait
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// ErrTimeout is returned when the condition is not met before the context
+// deadline expires.
+var ErrTimeout = errors.New("timed out")
+
+// Backoff controls how long to wait between checking the condition.
+type Backoff struct {
+	// Initial is the delay after the first check.
+	Initial time.Duration
+
+	// Max caps the delay between checks.
+	Max time.Duration
+
+	// Factor is multiplied with the delay after every check.
+	Factor float64
+
+	// Jitter randomises each delay by up to the given fraction of it, so
+	// that concurrent pollers don't hit the remote end at the same time.
+	Jitter float64
+}
+
+// DefaultBackoff is suitable for waiting on remote commands that take
+// anywhere from seconds to minutes to complete.
+var DefaultBackoff = Backoff{
+	Initial: 500 * time.Millisecond,
+	Max:     5 * time.Second,
+	Factor:  1.5,
+	Jitter:  0.1,
+}
+
+// ConditionFunc reports whether waiting is done. Returning an error stops
+// polling immediately.
+type ConditionFunc func(ctx context.Context) (done bool, err error)
+
+// Poll checks the condition right away and then again after every delay
+// until it is done, returns an error or the context is done.
+func Poll(ctx context.Context, backoff Backoff, condition ConditionFunc) error {
+	delay := backoff.Initial
+
+	for {
+		done, err := condition(ctx)
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+
+		timer := time.NewTimer(backoff.jitter(delay))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ErrTimeout
+			}
+			return ctx.Err()
+		}
+
+		delay = backoff.next(delay)
+	}
+}
+
+// PollWithTimeout is a convenience wrapper around Poll for callers that
+// only need a deadline.
+func PollWithTimeout(timeout time.Duration, backoff Backoff, condition ConditionFunc) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return Poll(ctx, backoff, condition)
+}
+
+func (b Backoff) next(delay time.Duration) time.Duration {
+	if b.Factor > 1 {
+		delay = time.Duration(float64(delay) * b.Factor)
+	}
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+func (b Backoff) jitter(delay time.Duration) time.Duration {
+	if b.Jitter <= 0 {
+		return delay
+	}
+	return delay + time.Duration(rand.Float64()*b.Jitter*float64(delay))
+}
@@ -0,0 +1,117 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fast polls often enough for tests to finish quickly.
+var fast = Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Factor: 2}
+
+func TestPoll(t *testing.T) {
+	errCheck := errors.New("check failed")
+
+	tests := []struct {
+		name      string
+		condition func(calls int) (bool, error)
+		wantErr   error
+		wantCalls int
+	}{
+		{
+			name:      "done right away",
+			condition: func(int) (bool, error) { return true, nil },
+			wantCalls: 1,
+		},
+		{
+			name:      "done after retries",
+			condition: func(calls int) (bool, error) { return calls == 3, nil },
+			wantCalls: 3,
+		},
+		{
+			name:      "error stops polling",
+			condition: func(calls int) (bool, error) { return false, errCheck },
+			wantErr:   errCheck,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Poll(context.Background(), fast, func(context.Context) (bool, error) {
+				calls++
+				return tt.condition(calls)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("condition was checked %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPollWithTimeout(t *testing.T) {
+	start := time.Now()
+	err := PollWithTimeout(20*time.Millisecond, fast, func(context.Context) (bool, error) {
+		return false, nil
+	})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("got error %v, want %v", err, ErrTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+}
+
+func TestPollCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := Poll(ctx, fast, func(context.Context) (bool, error) {
+		calls++
+		if calls == 2 {
+			cancel()
+		}
+		return false, nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+	if calls != 2 {
+		t.Errorf("condition was checked %d times after cancel", calls-2)
+	}
+}
+
+func TestBackoffNext(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Factor: 2}
+
+	want := []time.Duration{
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+
+	delay := b.Initial
+	for i, w := range want {
+		delay = b.next(delay)
+		if delay != w {
+			t.Errorf("delay %d is %s, want %s", i+1, delay, w)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	b := Backoff{Jitter: 0.1}
+
+	for range 100 {
+		if d := b.jitter(time.Second); d < time.Second || d > 1100*time.Millisecond {
+			t.Fatalf("jittered delay %s is outside of [1s, 1.1s]", d)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package wakeonlan
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToDevice returns a control function that binds the socket to the
+// network interface, so that packets leave through it even when they are
+// sent to the limited broadcast address, which is otherwise routed
+// through the interface of the default route.
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var err error
+		ctrlErr := c.Control(func(fd uintptr) {
+			err = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, name)
+		})
+		if ctrlErr != nil {
+			return ctrlErr
+		}
+		return err
+	}
+}
@@ -0,0 +1,72 @@
+package wakeonlan
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestSendBindsToInterface(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	err = Send("01:23:45:67:89:ab", Options{Addr: conn.LocalAddr().String(), Interface: "lo"})
+	if errors.Is(err, os.ErrPermission) {
+		t.Skip("binding to a device needs CAP_NET_RAW on this kernel")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := MagicPacket("01:23:45:67:89:ab", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 1024)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf[:n], want) {
+		t.Errorf("received %x, want %x", buf[:n], want)
+	}
+
+}
+
+func TestBindToDevice(t *testing.T) {
+	dialer := net.Dialer{Control: bindToDevice("lo")}
+	conn, err := dialer.Dial("udp", "127.0.0.1:9")
+	if errors.Is(err, os.ErrPermission) {
+		t.Skip("binding to a device needs CAP_NET_RAW on this kernel")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.(*net.UDPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var device string
+	raw.Control(func(fd uintptr) {
+		device, err = unix.GetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device != "lo" {
+		t.Errorf("socket is bound to %q, want %q", device, "lo")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package wakeonlan
+
+import "syscall"
+
+// bindToDevice returns nil, as sockets can't be bound to a network
+// interface. Packets are sent to the broadcast address of the interface
+// instead, unless a different address is given.
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -3,45 +3,255 @@ package wakeonlan
 import (
 	"fmt"
 	"net"
+	"strings"
+	"time"
+
+	"github.com/romantomjak/labctl/config"
+	"github.com/romantomjak/labctl/ssh"
 )
 
+// DefaultAddr is the limited broadcast address. Packets sent to it never
+// leave the local network segment.
+const DefaultAddr = "255.255.255.255:" + defaultPort
+
+// defaultPort is the echo port, which is used when address has no port.
+const defaultPort = "7"
+
+// repeatInterval is the delay between repeated packets.
+const repeatInterval = 100 * time.Millisecond
+
+type Options struct {
+	// Addr is the address packets are sent to, e.g. a directed broadcast
+	// address "10.10.0.255:9". Defaults to the broadcast address of the
+	// interface if one is given, or DefaultAddr otherwise.
+	Addr string
+
+	// Interface is the name of the local network interface packets are
+	// sent from. Defaults to the interface of the default route.
+	Interface string
+
+	// Repeat is how many times the packet is sent. Defaults to once.
+	Repeat int
+
+	// Password is the optional SecureOn password, given either in MAC
+	// format, e.g. "01:23:45:67:89:ab", or in IPv4 format, e.g. "1.2.3.4".
+	Password string
+}
+
 // Broadcast sends Wake-on-LAN packets.
 //
 // The MAC must be in EUI-48/MAC-48 format.
 func Broadcast(mac string) error {
+	return Send(mac, Options{})
+}
+
+// Wake sends Wake-on-LAN packets to the node using its configuration.
+// Packets are sent through the relay node if one is configured.
+func Wake(cfg *config.Config, node config.Node) error {
+	if node.MAC == "" {
+		return fmt.Errorf("mac address is not configured for %s", node.Name)
+	}
+
+	opts := Options{
+		Addr:      node.WOLBroadcast,
+		Interface: node.WOLInterface,
+		Repeat:    node.WOLRepeat,
+		Password:  node.WOLPassword,
+	}
+
+	if node.WOLVia == "" {
+		return Send(node.MAC, opts)
+	}
+
+	relay, ok := cfg.FindNode(node.WOLVia)
+	if !ok {
+		return fmt.Errorf("relay node %q is not defined in configuration", node.WOLVia)
+	}
+
+	// Relay connection is shared, so that waking several nodes through it
+	// only connects once.
+	client, err := ssh.Get(relay)
+	if err != nil {
+		return fmt.Errorf("ssh to %s: %w", relay.Name, err)
+	}
+	defer client.Close()
+
+	return Relay(client, node.MAC, opts)
+}
+
+// Relay sends Wake-on-LAN packets from the remote host. This is useful
+// when the target is on a network segment that local machine can't send
+// broadcasts to, but an always-on host on that segment is reachable.
+//
+// Interface option is ignored, packets are sent from the default route
+// of the remote host unless a directed broadcast address is given.
+func Relay(client *ssh.Client, mac string, opts Options) error {
+	packet, err := MagicPacket(mac, opts.Password)
+	if err != nil {
+		return err
+	}
+
+	addr := opts.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultPort)
+	}
+
+	if err := client.SendUDPBroadcast(addr, packet, max(opts.Repeat, 1)); err != nil {
+		return fmt.Errorf("relay: %w", err)
+	}
+
+	return nil
+}
+
+// Send sends Wake-on-LAN packets using the given options.
+//
+// The MAC must be in EUI-48/MAC-48 format.
+func Send(mac string, opts Options) error {
+	packet, err := MagicPacket(mac, opts.Password)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	addr := opts.Addr
+
+	if opts.Interface != "" {
+		ip, broadcast, err := interfaceAddrs(opts.Interface)
+		if err != nil {
+			return err
+		}
+
+		// Source address alone doesn't choose the interface packets leave
+		// through, routing does.
+		dialer.LocalAddr = &net.UDPAddr{IP: ip}
+		dialer.Control = bindToDevice(opts.Interface)
+		if addr == "" {
+			addr = net.JoinHostPort(broadcast.String(), defaultPort)
+		}
+	}
+
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	// Port is optional, e.g. "10.10.0.255".
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, defaultPort)
+	}
+
+	conn, err := dialer.Dial("udp", addr)
+	if err != nil {
+		return fmt.Errorf("dial udp: %w", err)
+	}
+	defer conn.Close()
+
+	repeat := max(opts.Repeat, 1)
+	for i := 0; i < repeat; i++ {
+		if i > 0 {
+			time.Sleep(repeatInterval)
+		}
+		if _, err := conn.Write(packet); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// MagicPacket returns the Wake-on-LAN payload for the MAC address, with
+// the SecureOn password appended if one is given.
+func MagicPacket(mac, password string) ([]byte, error) {
 	hwAddr, err := net.ParseMAC(mac)
 	if err != nil {
-		return fmt.Errorf("parse mac: %w", err)
+		return nil, fmt.Errorf("parse mac: %w", err)
 	}
 
 	if len(hwAddr) != 6 {
-		return fmt.Errorf("unsupported mac format")
+		return nil, fmt.Errorf("unsupported mac format")
+	}
+
+	secureOn, err := parsePassword(password)
+	if err != nil {
+		return nil, err
 	}
 
 	// Magic packet is a frame that contains anywhere within its payload 6 bytes of
 	// all 255 (FF FF FF FF FF FF in hexadecimal), followed by sixteen repetitions of
 	// the target computer's 48-bit MAC address, for a total of 102 bytes.
 	// See https://en.wikipedia.org/wiki/Wake-on-LAN
-	packet := make([]byte, 0, 102)
+	packet := make([]byte, 0, 102+len(secureOn))
 	packet = append(packet, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}...)
 	for i := 0; i < 16; i++ {
 		packet = append(packet, hwAddr...)
 	}
 
-	raddr, err := net.ResolveUDPAddr("udp", "255.255.255.255:7")
+	// SecureOn password is appended after the MAC repetitions and is
+	// checked by the network card before waking the computer up.
+	packet = append(packet, secureOn...)
+
+	return packet, nil
+}
+
+func parsePassword(password string) ([]byte, error) {
+	if password == "" {
+		return nil, nil
+	}
+
+	if strings.ContainsAny(password, ":-") {
+		b, err := net.ParseMAC(password)
+		if err != nil || len(b) != 6 {
+			return nil, fmt.Errorf("password must be 6 bytes in MAC format")
+		}
+		return b, nil
+	}
+
+	if ip := net.ParseIP(password).To4(); ip != nil {
+		return ip, nil
+	}
+
+	return nil, fmt.Errorf("password must be in MAC or IPv4 format")
+}
+
+// interfaceAddrs returns the first IPv4 address of the network interface
+// and the broadcast address of its subnet.
+func interfaceAddrs(name string) (net.IP, net.IP, error) {
+	iface, err := net.InterfaceByName(name)
 	if err != nil {
-		return fmt.Errorf("resolve udp addr: %w", err)
+		return nil, nil, fmt.Errorf("find interface: %w", err)
 	}
 
-	conn, err := net.DialUDP("udp", nil, raddr)
+	addrs, err := iface.Addrs()
 	if err != nil {
-		return fmt.Errorf("dial udp: %w", err)
+		return nil, nil, fmt.Errorf("interface addrs: %w", err)
 	}
-	defer conn.Close()
 
-	if _, err := conn.Write(packet); err != nil {
-		return fmt.Errorf("write: %w", err)
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		ip := ipNet.IP.To4()
+		if ip == nil {
+			continue
+		}
+
+		mask := net.IP(ipNet.Mask).To4()
+		if mask == nil {
+			mask = net.IP(ipNet.Mask[len(ipNet.Mask)-4:])
+		}
+
+		broadcast := make(net.IP, 4)
+		for i := range ip {
+			broadcast[i] = ip[i] | ^mask[i]
+		}
+
+		return ip, broadcast, nil
 	}
 
-	return nil
+	return nil, nil, fmt.Errorf("interface %s has no IPv4 address", name)
 }